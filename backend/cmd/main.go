@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata" // 内置时区数据，保证在没有系统时区库的环境中也能解析用户时区
 
 	"backend/internal/config"
+	"backend/internal/mailer"
 	"backend/internal/models"
 	"backend/internal/routes"
+	"backend/internal/services"
+	"backend/internal/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -25,17 +31,80 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// 旧版字符串截止日期需要在自动迁移前转换
+	if err := services.MigrateLegacyDueDates(db); err != nil {
+		log.Fatal("Failed to migrate due dates:", err)
+	}
+
 	// 自动迁移表结构
-	db.AutoMigrate(
+	err = db.AutoMigrate(
 		&models.User{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordReset{},
+		&models.RecoveryCode{},
+		&models.TwoFactorChallenge{},
+		&models.PersonalAccessToken{},
+		&models.UserIdentity{},
+		&models.OIDCLogin{},
+		&models.LoginThrottle{},
+		&models.AuditLog{},
+		&models.Tag{},
+		&models.Category{},
+		&models.TaskSeries{},
 		&models.Task{},
+		&models.Subtask{},
+		&models.TaskDependency{},
+		&models.TaskResource{},
+		&models.Blob{},
+		&models.UserSetting{},
+		&models.UploadSession{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	if err := services.MigrateLegacyTags(db); err != nil {
+		log.Fatal("Failed to migrate tags:", err)
+	}
+	if err := services.MigrateLegacyCategories(db); err != nil {
+		log.Fatal("Failed to migrate categories:", err)
+	}
+	if err := services.MigrateTaskStatus(db); err != nil {
+		log.Fatal("Failed to migrate task status:", err)
+	}
+
 	log.Println("数据库迁移成功！") // 增加提示
 
+	// 初始化文件存储
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+	uploads := services.NewUploadService(store, map[services.UploadKind]int64{
+		services.UploadAvatar:     int64(cfg.MaxAvatarSizeMB) << 20,
+		services.UploadBackground: int64(cfg.MaxBackgroundSizeMB) << 20,
+		services.UploadAttachment: int64(cfg.MaxAttachmentSizeMB) << 20,
+	}, int64(cfg.StorageQuotaMB)<<20)
+	resumable, err := services.NewResumableUploads(uploads, cfg.ResumableUploadDir,
+		int64(cfg.MaxResumableSizeMB)<<20, cfg.ResumableUploadExpiry)
+	if err != nil {
+		log.Fatal("Failed to init resumable uploads:", err)
+	}
+
+	// 邮件发送
+	sender, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to init mailer:", err)
+	}
+
+	// 启动回收站自动清理
+	go services.RunTrashPurger(context.Background(), db, uploads, cfg.TrashRetention(), cfg.TrashPurgeInterval)
+	// 定期清理过期的未完成上传
+	go resumable.RunCleaner(context.Background(), db, time.Hour)
+	// 旧版本单独保存的附件迁移到按内容去重的存储
+	go uploads.BackfillBlobs(context.Background(), db)
+
 	// 设置Gin模式
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -43,18 +112,22 @@ func main() {
 
 	// 初始化Gin
 	router := gin.Default()
+	// 默认信任所有代理，客户端可以伪造 X-Forwarded-For 绕过按 IP 的登录限制
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// 注册CORS中间件
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"}, // 前端端口
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Tus-Resumable", "Upload-Length", "Upload-Offset"},
 		AllowCredentials: true,
 	}))
 
 	// 设置路由
-	routes.RegisterRoutes(router, db, cfg.JWTSecret)
+	routes.RegisterRoutes(router, db, cfg, uploads, resumable, sender)
 
 	// 启动服务器
 	log.Printf("Server is running on port %s", cfg.ServerPort)
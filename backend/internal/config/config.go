@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +18,84 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	JWTSecret  string
+
+	// 反向代理的地址或网段，只有来自这些地址的请求才采用 X-Forwarded-For 中的客户端 IP；
+	// 为空时直接使用连接的对端地址。登录限制和审计记录都依赖客户端 IP，不能随意信任
+	TrustedProxies []string
+
+	// 访问令牌和刷新令牌的有效期
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// 前端地址，用于生成邮件中的链接
+	AppBaseURL string
+	// 找回密码链接的有效期
+	PasswordResetTTL time.Duration
+	// 窗口期内同一邮箱或同一 IP 最多请求发送重置密码邮件的次数
+	PasswordResetMaxPerEmail int
+	PasswordResetMaxPerIP    int
+	PasswordResetWindow      time.Duration
+	// 邮箱验证链接的有效期
+	EmailVerifyTTL time.Duration
+	// 两步验证：验证器应用中显示的名称，以及输入密码后输入动态码的时限
+	TOTPIssuer            string
+	TwoFactorChallengeTTL time.Duration
+
+	// OpenID Connect 登录，OIDCIssuer 为空时不启用。OIDCRedirectURL 为前端的回调页面，
+	// 需要在身份提供方登记；为空时使用 AppBaseURL + /oidc/callback
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string // 空格分隔，需包含 openid 和 email
+	OIDCProviderName string // 登录按钮上显示的名称
+
+	// 登录失败限制：窗口期内同一用户名或同一 IP 失败达到次数后临时锁定，
+	// 之后每次失败锁定时长翻倍，直到上限
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginFailureWindow    time.Duration
+	LoginLockout          time.Duration
+	LoginMaxLockout       time.Duration
+
+	// 发信 SMTP 服务器，SMTPHost 为空时邮件只写入日志
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTLS      string // starttls / tls / none
+
+	// 回收站中任务的保留天数，超过后由后台任务彻底删除
+	TrashRetentionDays int
+	// 回收站清理任务的执行间隔
+	TrashPurgeInterval time.Duration
+
+	// 文件存储：local 保存在 UploadDir 下，s3 保存到 S3 兼容的对象存储
+	StorageDriver string
+	// 上传文件的根目录（local 存储），按 类型/用户 分子目录保存
+	UploadDir string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool // MinIO 等需要 path-style 地址
+	// 预签名下载地址的有效期，为 0 时下载由后端转发
+	S3PresignExpiry time.Duration
+
+	// 各类上传的大小上限（MB）
+	MaxAvatarSizeMB     int
+	MaxBackgroundSizeMB int
+	MaxAttachmentSizeMB int
+	// 每个用户默认的存储配额（MB），0 表示不限制
+	StorageQuotaMB int
+
+	// 断点续传：未完成的数据保存在本地目录，超过有效期未更新的上传会被清理
+	ResumableUploadDir    string
+	ResumableUploadExpiry time.Duration
+	MaxResumableSizeMB    int
 }
 
 func LoadConfig() *Config {
@@ -32,9 +113,72 @@ func LoadConfig() *Config {
 		DBPassword: getEnv("DB_PASSWORD", "123456"),
 		DBName:     getEnv("DB_NAME", "project"),
 		JWTSecret:  getEnv("JWT_SECRET", "your_jwt_secret"),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		AppBaseURL:       getEnv("APP_BASE_URL", "http://localhost:5173"),
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+
+		PasswordResetMaxPerEmail: getEnvInt("PASSWORD_RESET_MAX_PER_EMAIL", 3),
+		PasswordResetMaxPerIP:    getEnvInt("PASSWORD_RESET_MAX_PER_IP", 10),
+		PasswordResetWindow:      getEnvDuration("PASSWORD_RESET_WINDOW", time.Hour),
+		EmailVerifyTTL:           getEnvDuration("EMAIL_VERIFY_TTL", 24*time.Hour),
+
+		TOTPIssuer:            getEnv("TOTP_ISSUER", "TodoList"),
+		TwoFactorChallengeTTL: getEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCProviderName: getEnv("OIDC_PROVIDER_NAME", "SSO"),
+
+		LoginMaxFailures:      getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginFailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockout:          getEnvDuration("LOGIN_LOCKOUT", time.Minute),
+		LoginMaxLockout:       getEnvDuration("LOGIN_MAX_LOCKOUT", time.Hour),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "no-reply@localhost"),
+		SMTPTLS:      getEnv("SMTP_TLS", "starttls"),
+
+		// 为 0 或负数时会立即清空回收站或导致定时器 panic，只接受正数
+		TrashRetentionDays: getEnvPositiveInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeInterval: getEnvPositiveDuration("TRASH_PURGE_INTERVAL", time.Hour),
+
+		StorageDriver:       getEnv("STORAGE_DRIVER", "local"),
+		UploadDir:           getEnv("UPLOAD_DIR", "uploads"),
+		S3Endpoint:          getEnv("S3_ENDPOINT", ""),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:            getEnv("S3_BUCKET", ""),
+		S3AccessKey:         getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:         getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:         getEnvBool("S3_PATH_STYLE", true),
+		S3PresignExpiry:     getEnvDuration("S3_PRESIGN_EXPIRY", 15*time.Minute),
+		MaxAvatarSizeMB:     getEnvInt("MAX_AVATAR_SIZE_MB", 2),
+		MaxBackgroundSizeMB: getEnvInt("MAX_BACKGROUND_SIZE_MB", 5),
+		MaxAttachmentSizeMB: getEnvInt("MAX_ATTACHMENT_SIZE_MB", 20),
+		StorageQuotaMB:      getEnvInt("STORAGE_QUOTA_MB", 1024),
+
+		ResumableUploadDir:    getEnv("RESUMABLE_UPLOAD_DIR", "uploads_tmp"),
+		ResumableUploadExpiry: getEnvDuration("RESUMABLE_UPLOAD_EXPIRY", 24*time.Hour),
+		MaxResumableSizeMB:    getEnvInt("MAX_RESUMABLE_SIZE_MB", 2048),
 	}
 }
 
+// TrashRetention 回收站保留时长
+func (c *Config) TrashRetention() time.Duration {
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -42,3 +186,58 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvList 逗号分隔的列表，未设置时为 nil
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvPositiveInt 与 getEnvInt 相同，但值不大于 0 时使用默认值
+func getEnvPositiveInt(key string, defaultValue int) int {
+	value := getEnvInt(key, defaultValue)
+	if value <= 0 {
+		log.Printf("Warning: %s must be positive, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvPositiveDuration 与 getEnvDuration 相同，但值不大于 0 时使用默认值
+func getEnvPositiveDuration(key string, defaultValue time.Duration) time.Duration {
+	value := getEnvDuration(key, defaultValue)
+	if value <= 0 {
+		log.Printf("Warning: %s must be positive, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
@@ -1,29 +1,48 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"backend/internal/models"
+	"backend/internal/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthController struct {
-	DB        *gorm.DB
-	JWTSecret string
+	DB         *gorm.DB
+	Sessions   *services.SessionService
+	Accounts   *services.AccountService
+	TwoFactor  *services.TwoFactorService
+	Guard      *services.LoginGuard
+	ResetGuard *services.LoginGuard // 限制发送重置密码邮件的频率
+	OIDC       *services.OIDCService
+	Uploads    *services.UploadService
 }
 
-func NewAuthController(db *gorm.DB, jwtSecret string) *AuthController {
+func NewAuthController(db *gorm.DB, sessions *services.SessionService, accounts *services.AccountService, twoFactor *services.TwoFactorService, guard, resetGuard *services.LoginGuard, oidc *services.OIDCService, uploads *services.UploadService) *AuthController {
 	return &AuthController{
-		DB:        db,
-		JWTSecret: jwtSecret,
+		DB:         db,
+		Sessions:   sessions,
+		Accounts:   accounts,
+		TwoFactor:  twoFactor,
+		Guard:      guard,
+		ResetGuard: resetGuard,
+		OIDC:       oidc,
+		Uploads:    uploads,
 	}
 }
 
+// 登录被临时锁定时响应中的 code，客户端据此提示稍后再试
+const codeLoginLocked = 2
+
 // Register 用户注册
 func (ac *AuthController) Register(c *gin.Context) {
 	var userInput struct {
@@ -61,13 +80,21 @@ func (ac *AuthController) Register(c *gin.Context) {
 		Username: userInput.Username,
 		Password: string(hashedPassword),
 		Nickname: nickname,
-		Email:    userInput.Email,
+	}
+	// 邮箱在验证之前不算生效
+	if userInput.Email != "" {
+		if err := ac.Accounts.ChangeEmail(&user, userInput.Email); err != nil {
+			status, msg := emailErrorStatus(err)
+			c.JSON(status, gin.H{"code": 1, "msg": msg})
+			return
+		}
 	}
 
 	if err := ac.DB.Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "用户创建失败"})
 		return
 	}
+	ac.sendEmailVerification(user)
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "注册成功"})
 }
@@ -84,25 +111,130 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	// 锁定期间不再校验密码
+	wait, err := ac.Guard.Check(loginInput.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "登录失败"})
+		return
+	}
+	if wait > 0 {
+		loginLocked(c, wait)
+		return
+	}
+
 	// 查找用户
 	var user models.User
 	if err := ac.DB.Where("username = ?", loginInput.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "用户名或密码错误"})
+		ac.loginFailed(c, loginInput.Username, nil, "用户名或密码错误")
 		return
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginInput.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "用户名或密码错误"})
+		ac.loginFailed(c, loginInput.Username, &user.ID, "用户名或密码错误")
+		return
+	}
+
+	ac.beginLogin(c, &user)
+}
+
+// beginLogin 身份验证通过后登录；开启了两步验证时先不签发令牌，客户端凭 challengeToken 提交动态码
+func (ac *AuthController) beginLogin(c *gin.Context, user *models.User) {
+	if user.TOTPEnabled {
+		challenge, err := ac.TwoFactor.CreateChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "登录失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"msg":  "请输入两步验证码",
+			"data": gin.H{
+				"twoFactorRequired": true,
+				"challengeToken":    challenge,
+				"expiresIn":         int64(ac.TwoFactor.ChallengeTTL / time.Second),
+			},
+		})
+		return
+	}
+
+	ac.completeLogin(c, user)
+}
+
+// VerifyTwoFactor 登录第二步：提交登录验证令牌和动态码（或恢复码），通过后签发令牌
+func (ac *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	// 登录验证可能是在锁定之前签发的，锁定期间同样不能提交动态码
+	pending, err := ac.TwoFactor.ChallengeUser(input.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": err.Error()})
+		return
+	}
+	wait, err := ac.Guard.Check(pending.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "登录失败"})
+		return
+	}
+	if wait > 0 {
+		loginLocked(c, wait)
+		return
+	}
+
+	user, err := ac.TwoFactor.CompleteChallenge(input.ChallengeToken, input.Code)
+	if err != nil {
+		// 验证码错误同样计入登录失败，避免反复登录来猜测动态码
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			ac.loginFailed(c, user.Username, &user.ID, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrInvalidChallenge) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "登录失败"})
 		return
 	}
+	ac.completeLogin(c, user)
+}
 
-	// 生成JWT令牌
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": user.ID,
-		"exp":    time.Now().Add(time.Hour * 24).Unix(),
+// loginFailed 记录登录失败并响应，失败次数达到上限时响应锁定
+func (ac *AuthController) loginFailed(c *gin.Context, username string, userID *uint, msg string) {
+	wait, err := ac.Guard.RecordFailure(username, c.ClientIP(), userID)
+	if err != nil {
+		log.Printf("记录登录失败出错: %v", err)
+	}
+	if wait > 0 {
+		loginLocked(c, wait)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": msg})
+}
+
+// loginLocked 响应 429，Retry-After 为剩余的锁定秒数
+func loginLocked(c *gin.Context, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code": codeLoginLocked,
+		"msg":  "登录失败次数过多，请 " + strconv.Itoa(seconds) + " 秒后再试",
+		"data": gin.H{"retryAfter": seconds},
 	})
-	tokenString, err := token.SignedString([]byte(ac.JWTSecret))
+}
+
+// completeLogin 创建会话，签发访问令牌和刷新令牌
+func (ac *AuthController) completeLogin(c *gin.Context, user *models.User) {
+	if err := ac.Guard.RecordSuccess(user.Username); err != nil {
+		log.Printf("清除登录失败计数出错: %v", err)
+	}
+	tokens, err := ac.Sessions.Login(user.ID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(500, gin.H{"code": 1, "msg": "生成token失败"})
 		return
@@ -113,7 +245,9 @@ func (ac *AuthController) Login(c *gin.Context) {
 		"code": 0,
 		"msg":  "登录成功",
 		"data": gin.H{
-			"token": tokenString,
+			"token":        tokens.AccessToken,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
 			"user": gin.H{
 				"username": user.Username,
 				"nickname": user.Nickname,
@@ -122,6 +256,148 @@ func (ac *AuthController) Login(c *gin.Context) {
 	})
 }
 
+// Refresh 用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	tokens, err := ac.Sessions.Refresh(input.RefreshToken, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "刷新token失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tokens})
+}
+
+// Logout 注销当前会话
+func (ac *AuthController) Logout(c *gin.Context) {
+	sessionID := c.GetString("sessionID")
+	if err := ac.Sessions.Revoke(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "退出登录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "已退出登录"})
+}
+
+// ForgotPassword 发送重置密码邮件；无论邮箱是否存在都返回相同结果，避免泄露账号信息
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	// 同一邮箱或 IP 请求过于频繁时拒绝，避免被用来向他人邮箱轰炸
+	ip := c.ClientIP()
+	wait, err := ac.ResetGuard.Check(input.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "发送失败"})
+		return
+	}
+	if wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"code": 1, "msg": "请求过于频繁，请稍后再试", "data": gin.H{"retryAfter": seconds}})
+		return
+	}
+	// 每次请求都计数，而不只是失败的
+	if _, err := ac.ResetGuard.RecordFailure(input.Email, ip, nil); err != nil {
+		log.Printf("记录重置密码请求出错: %v", err)
+	}
+
+	// 在后台发送，响应时间不随邮箱是否存在而变化
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := ac.Accounts.RequestPasswordReset(ctx, email); err != nil {
+			log.Printf("发送重置密码邮件失败: %v", err)
+		}
+	}(input.Email)
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "如果该邮箱已注册，重置密码的邮件已发送"})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required,min=8"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	if err := ac.Accounts.ResetPassword(input.Token, input.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "重置密码失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "密码已重置，请重新登录，原有的个人访问令牌已失效"})
+}
+
+// GetSessions 当前用户已登录的设备列表
+func (ac *AuthController) GetSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	sessions, err := ac.Sessions.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取会话失败"})
+		return
+	}
+	current := c.GetString("sessionID")
+	data := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		data = append(data, gin.H{
+			"id":         s.ID,
+			"device":     services.DescribeDevice(s.UserAgent),
+			"userAgent":  s.UserAgent,
+			"ip":         s.IP,
+			"createdAt":  s.CreatedAt,
+			"lastSeenAt": s.LastSeenAt,
+			"current":    s.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": data})
+}
+
+// RevokeSession 注销指定会话（可以是当前会话）
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	err := ac.Sessions.RevokeUserSession(c.GetUint("userID"), c.Param("sessionId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "会话不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "注销会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "已注销"})
+}
+
+// RevokeOtherSessions 注销除当前会话以外的所有会话
+func (ac *AuthController) RevokeOtherSessions(c *gin.Context) {
+	n, err := ac.Sessions.RevokeOtherSessions(c.GetUint("userID"), c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "注销会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "已注销其他设备", "data": gin.H{"revoked": n}})
+}
+
 // GetUserProfile 获取用户信息
 func (ac *AuthController) GetUserProfile(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -136,11 +412,7 @@ func (ac *AuthController) GetUserProfile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"username":  user.Username,
-		"email":     user.Email,
-		"avatarUrl": user.AvatarURL,
-	})
+	c.JSON(http.StatusOK, profileResponse(&user))
 }
 
 // UpdateUserProfile 更新用户信息
@@ -178,26 +450,98 @@ func (ac *AuthController) UpdateUserProfile(c *gin.Context) {
 		user.Username = profileInput.Username
 	}
 
+	// 新邮箱验证通过后才会替换当前邮箱
+	emailChanged := false
 	if profileInput.Email != "" {
-		// 检查邮箱是否已存在
-		var existingUser models.User
-		if err := ac.DB.Where("email = ? AND id != ?", profileInput.Email, userID).First(&existingUser).Error; err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
+		pending := user.PendingEmail
+		if err := ac.Accounts.ChangeEmail(&user, profileInput.Email); err != nil {
+			status, msg := emailErrorStatus(err)
+			c.JSON(status, gin.H{"error": msg})
 			return
 		}
-		user.Email = profileInput.Email
+		emailChanged = user.PendingEmail != pending || !user.EmailVerified
 	}
 
 	if err := ac.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	if emailChanged {
+		ac.sendEmailVerification(user)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"username":  user.Username,
-		"email":     user.Email,
-		"avatarUrl": user.AvatarURL,
-	})
+	c.JSON(http.StatusOK, profileResponse(&user))
+}
+
+// VerifyEmail 打开邮件中的验证链接后由前端调用
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	user, err := ac.Accounts.VerifyEmail(input.Token)
+	if err != nil {
+		status, msg := emailErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "邮箱验证成功", "data": gin.H{"email": user.Email}})
+}
+
+// ResendEmailVerification 重新发送验证邮件
+func (ac *AuthController) ResendEmailVerification(c *gin.Context) {
+	var user models.User
+	if err := ac.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "用户不存在"})
+		return
+	}
+	if user.PendingEmail == "" && (user.Email == "" || user.EmailVerified) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "没有需要验证的邮箱"})
+		return
+	}
+	if err := ac.Accounts.SendEmailVerification(c.Request.Context(), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "发送验证邮件失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "验证邮件已发送"})
+}
+
+// 在后台发送验证邮件，失败只记录日志，用户可以稍后重新发送
+func (ac *AuthController) sendEmailVerification(user models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := ac.Accounts.SendEmailVerification(ctx, &user); err != nil {
+			log.Printf("发送验证邮件失败: %v", err)
+		}
+	}()
+}
+
+func profileResponse(user *models.User) gin.H {
+	return gin.H{
+		"username":         user.Username,
+		"email":            user.Email,
+		"emailVerified":    user.EmailVerified,
+		"pendingEmail":     user.PendingEmail,
+		"twoFactorEnabled": user.TOTPEnabled,
+		"avatarUrl":        user.AvatarURL,
+		"avatarUrls":       services.AvatarURLs(user.AvatarURL),
+	}
+}
+
+// emailErrorStatus 将邮箱相关错误转换为状态码和提示
+func emailErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrInvalidVerifyToken):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, services.ErrEmailTaken):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "处理邮箱失败"
+	}
 }
 
 // UploadAvatar 上传头像
@@ -214,13 +558,6 @@ func (ac *AuthController) UploadAvatar(c *gin.Context) {
 		return
 	}
 
-	// 在实际应用中，应该将文件保存到安全的存储位置
-	filePath := "uploads/avatars/" + file.Filename
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
-	}
-
 	// 更新用户头像路径
 	var user models.User
 	if err := ac.DB.First(&user, userID).Error; err != nil {
@@ -228,13 +565,44 @@ func (ac *AuthController) UploadAvatar(c *gin.Context) {
 		return
 	}
 
-	user.AvatarURL = filePath
-	if err := ac.DB.Save(&user).Error; err != nil {
+	// 处理后的头像通常比原图小，按原图大小预估是否超出配额
+	if err := ac.Uploads.CheckQuota(ac.DB, user.ID, file.Size, user.AvatarSize); err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// 裁剪并生成各个尺寸，AvatarURL 保存最大的一张
+	key, size, err := ac.Uploads.SaveAvatar(ctx, user.ID, file)
+	if err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	oldKey := ac.Uploads.KeyFromURL(user.AvatarURL, services.UploadAvatar, user.ID)
+	user.AvatarURL = ac.Uploads.PublicURL(key)
+	user.AvatarSize = size
+	err = ac.Uploads.CommitWithinQuota(ac.DB, user.ID, func(tx *gorm.DB) error {
+		return tx.Model(&user).Select("avatar_url", "avatar_size").Updates(&user).Error
+	})
+	if err != nil {
+		ac.Uploads.RemoveAvatar(ctx, key)
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status, msg := uploadErrorStatus(err)
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	ac.Uploads.RemoveAvatar(ctx, oldKey)
 
-	c.JSON(http.StatusOK, gin.H{"avatarUrl": filePath})
+	c.JSON(http.StatusOK, gin.H{
+		"avatarUrl":  user.AvatarURL,
+		"avatarUrls": services.AvatarURLs(user.AvatarURL),
+	})
 }
 
 // ChangePassword 修改密码
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCConfig 是否启用第三方登录，前端据此显示登录按钮
+func (ac *AuthController) OIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": gin.H{
+		"enabled":      ac.OIDC.Enabled(),
+		"providerName": ac.OIDC.Name,
+	}})
+}
+
+// OIDCAuthorize 返回身份提供方的授权地址，前端保存 state 后跳转
+func (ac *AuthController) OIDCAuthorize(c *gin.Context) {
+	authURL, state, err := ac.OIDC.AuthorizeURL(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		log.Printf("生成 OpenID Connect 授权地址失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"code": 1, "msg": "无法连接身份提供方"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": gin.H{"url": authURL, "state": state}})
+}
+
+// OIDCCallback 前端回调页面提交授权码和 state，校验通过后按普通登录返回令牌（或两步验证）
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	var input struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	claims, err := ac.OIDC.Exchange(c.Request.Context(), input.Code, input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": err.Error()})
+		case errors.Is(err, services.ErrInvalidOIDCState), errors.Is(err, services.ErrInvalidIDToken),
+			errors.Is(err, services.ErrOIDCCodeRejected):
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": err.Error()})
+		default:
+			log.Printf("OpenID Connect 登录失败: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"code": 1, "msg": "第三方登录失败"})
+		}
+		return
+	}
+
+	user, err := ac.OIDC.FindOrCreateUser(claims, c.ClientIP())
+	if err != nil {
+		log.Printf("关联第三方账号失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "第三方登录失败"})
+		return
+	}
+	ac.beginLogin(c, user)
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CategoryController struct {
+	DB *gorm.DB
+}
+
+func NewCategoryController(db *gorm.DB) *CategoryController {
+	return &CategoryController{DB: db}
+}
+
+// 获取分类列表，默认不含已归档分类
+func (cc *CategoryController) GetCategories(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	query := cc.DB.Where("user_id = ?", userID)
+	if c.Query("archived") != "true" {
+		query = query.Where("archived = ?", false)
+	}
+
+	var categories []models.Category
+	if err := query.Order("sort_order asc, id asc").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取分类失败"})
+		return
+	}
+
+	var counts []struct {
+		CategoryID uint
+		Total      int64
+	}
+	if err := cc.DB.Model(&models.Task{}).
+		Select("category_id, COUNT(*) AS total").
+		Where("user_id = ? AND is_deleted = ? AND category_id IS NOT NULL", userID, false).
+		Group("category_id").
+		Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取分类失败"})
+		return
+	}
+	byCategory := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		byCategory[row.CategoryID] = row.Total
+	}
+	for i := range categories {
+		categories[i].TaskCount = byCategory[categories[i].ID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": categories})
+}
+
+// 创建分类
+func (cc *CategoryController) CreateCategory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	var input struct {
+		Name  string `json:"name" binding:"required,max=50"`
+		Color string `json:"color" binding:"max=20"`
+		Icon  string `json:"icon" binding:"max=50"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "分类名不能为空"})
+		return
+	}
+
+	var count int64
+	cc.DB.Model(&models.Category{}).Where("user_id = ? AND name = ?", userID, name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "分类已存在"})
+		return
+	}
+
+	// 新分类排在最后
+	var maxOrder struct{ Value *int }
+	cc.DB.Model(&models.Category{}).Select("MAX(sort_order) AS value").Where("user_id = ?", userID).Scan(&maxOrder)
+	sortOrder := 0
+	if maxOrder.Value != nil {
+		sortOrder = *maxOrder.Value + 1
+	}
+
+	category := models.Category{
+		UserID:    userID.(uint),
+		Name:      name,
+		Color:     input.Color,
+		Icon:      input.Icon,
+		SortOrder: sortOrder,
+	}
+	if err := cc.DB.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "创建分类失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "创建成功", "data": category})
+}
+
+// 更新分类（重命名、颜色、图标、排序、归档）
+func (cc *CategoryController) UpdateCategory(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var category models.Category
+	if err := cc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&category).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "分类不存在"})
+		return
+	}
+
+	var req struct {
+		Name      *string `json:"name" binding:"omitempty,max=50"`
+		Color     *string `json:"color" binding:"omitempty,max=20"`
+		Icon      *string `json:"icon" binding:"omitempty,max=50"`
+		SortOrder *int    `json:"sortOrder"`
+		Archived  *bool   `json:"archived"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(400, gin.H{"code": 1, "msg": "分类名不能为空"})
+			return
+		}
+		var count int64
+		cc.DB.Model(&models.Category{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, category.ID).Count(&count)
+		if count > 0 {
+			c.JSON(400, gin.H{"code": 1, "msg": "分类已存在"})
+			return
+		}
+		category.Name = name
+	}
+	if req.Color != nil {
+		category.Color = *req.Color
+	}
+	if req.Icon != nil {
+		category.Icon = *req.Icon
+	}
+	if req.SortOrder != nil {
+		category.SortOrder = *req.SortOrder
+	}
+	if req.Archived != nil {
+		category.Archived = *req.Archived
+	}
+
+	if err := cc.DB.Save(&category).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": category})
+}
+
+// 按给定顺序重新排列分类
+func (cc *CategoryController) ReorderCategories(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		IDs []uint `json:"ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.IDs {
+			if err := tx.Model(&models.Category{}).Where("id = ? AND user_id = ?", id, userID).Update("sort_order", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "排序失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "排序成功"})
+}
+
+// 删除分类，原分类下的任务变为未分类
+func (cc *CategoryController) DeleteCategory(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var category models.Category
+	if err := cc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&category).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "分类不存在"})
+		return
+	}
+
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Task{}).Where("category_id = ?", category.ID).Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TaskSeries{}).Where("category_id = ?", category.ID).Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已删除"})
+}
+
+// categoryErrorStatus 将任务设置分类时的错误转换为状态码和提示
+func categoryErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound), errors.Is(err, services.ErrCategoryArchived),
+		errors.Is(err, services.ErrInvalidCategoryName):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return http.StatusInternalServerError, "设置分类失败"
+	}
+}
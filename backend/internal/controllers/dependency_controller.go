@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DependencyController struct {
+	DB *gorm.DB
+}
+
+func NewDependencyController(db *gorm.DB) *DependencyController {
+	return &DependencyController{DB: db}
+}
+
+// 获取任务的依赖：blockedBy 为阻塞它的任务，blocking 为被它阻塞的任务
+func (dc *DependencyController) GetDependencies(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := dc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+
+	var blockedBy, blocking []models.Task
+	if err := dc.DB.Where("id IN (SELECT blocker_id FROM task_dependencies WHERE task_id = ?)", task.ID).Order("id").Find(&blockedBy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取依赖失败"})
+		return
+	}
+	if err := dc.DB.Where("id IN (SELECT task_id FROM task_dependencies WHERE blocker_id = ?)", task.ID).Order("id").Find(&blocking).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取依赖失败"})
+		return
+	}
+	loc := services.UserLocation(dc.DB, task.UserID)
+	decorateTasks(blockedBy, loc)
+	decorateTasks(blocking, loc)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": gin.H{"blockedBy": blockedBy, "blocking": blocking}})
+}
+
+// 添加依赖：当前任务被 blockerId 阻塞
+func (dc *DependencyController) AddDependency(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := dc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+	var req struct {
+		BlockerID uint `json:"blockerId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	var blocker models.Task
+	if err := dc.DB.Where("id = ? AND user_id = ?", req.BlockerID, userID).First(&blocker).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "依赖的任务不存在"})
+		return
+	}
+
+	err := dc.DB.Transaction(func(tx *gorm.DB) error {
+		return services.AddDependency(tx, task.UserID, task.ID, blocker.ID)
+	})
+	switch {
+	case errors.Is(err, services.ErrDependencySelf):
+		c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
+		return
+	case errors.Is(err, services.ErrDependencyCycle):
+		c.JSON(409, gin.H{"code": 1, "msg": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"code": 1, "msg": "添加依赖失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "添加成功"})
+}
+
+// 删除依赖
+func (dc *DependencyController) RemoveDependency(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := dc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+	result := dc.DB.Where("task_id = ? AND blocker_id = ?", task.ID, c.Param("blockerId")).Delete(&models.TaskDependency{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"code": 1, "msg": "依赖不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已删除"})
+}
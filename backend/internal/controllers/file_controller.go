@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/services"
+	"backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileController 提供头像、背景图片等公开文件的访问，附件需通过任务接口下载
+type FileController struct {
+	Uploads *services.UploadService
+}
+
+func NewFileController(uploads *services.UploadService) *FileController {
+	return &FileController{Uploads: uploads}
+}
+
+// GetFile 读取公开文件，存储支持预签名时重定向到存储地址
+func (fc *FileController) GetFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !strings.HasPrefix(key, string(services.UploadAvatar)+"/") && !strings.HasPrefix(key, string(services.UploadBackground)+"/") {
+		c.JSON(404, gin.H{"code": 1, "msg": "文件不存在"})
+		return
+	}
+	serveStoredFile(c, fc.Uploads, key, "", "")
+}
+
+// serveStoredFile 输出存储中的文件；filename 非空时作为附件下载
+func serveStoredFile(c *gin.Context, uploads *services.UploadService, key, filename, contentType string) {
+	ctx := c.Request.Context()
+	if url, err := uploads.Store.PresignGet(ctx, key, filename); err == nil && url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	obj, err := uploads.Store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.JSON(404, gin.H{"code": 1, "msg": "文件不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "读取文件失败"})
+		return
+	}
+	defer obj.Body.Close()
+
+	if contentType == "" {
+		contentType = obj.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	headers := map[string]string{"X-Content-Type-Options": "nosniff"}
+	if filename != "" {
+		headers["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	} else {
+		headers["Cache-Control"] = "private, max-age=" + strconv.Itoa(24*3600)
+	}
+	c.DataFromReader(http.StatusOK, obj.Size, contentType, obj.Body, headers)
+}
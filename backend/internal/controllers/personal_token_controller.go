@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PersonalTokenController struct {
+	Tokens *services.PersonalTokenService
+}
+
+func NewPersonalTokenController(tokens *services.PersonalTokenService) *PersonalTokenController {
+	return &PersonalTokenController{Tokens: tokens}
+}
+
+// GetTokens 当前用户的个人访问令牌（不含令牌本身）
+func (pc *PersonalTokenController) GetTokens(c *gin.Context) {
+	tokens, err := pc.Tokens.List(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取访问令牌失败"})
+		return
+	}
+	data := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		data = append(data, tokenResponse(&tokens[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": data})
+}
+
+// CreateToken 创建个人访问令牌，响应中的 token 只返回这一次
+func (pc *PersonalTokenController) CreateToken(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes"`        // 为空时只有只读权限
+		ExpiresInDays int      `json:"expiresInDays"` // 0 表示不过期
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Name) == "" || input.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	record, token, err := pc.Tokens.Create(c.GetUint("userID"), input.Name, input.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error(), "data": gin.H{"scopes": services.AllScopes}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "创建访问令牌失败"})
+		return
+	}
+	data := tokenResponse(record)
+	data["token"] = token
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "访问令牌已创建，请立即复制，之后将无法再次查看", "data": data})
+}
+
+// RevokeToken 撤销个人访问令牌
+func (pc *PersonalTokenController) RevokeToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	err = pc.Tokens.Revoke(c.GetUint("userID"), uint(tokenID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "访问令牌不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "撤销访问令牌失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "已撤销"})
+}
+
+func tokenResponse(t *models.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":         t.ID,
+		"name":       t.Name,
+		"prefix":     t.Prefix,
+		"scopes":     strings.Fields(t.Scopes),
+		"expiresAt":  t.ExpiresAt,
+		"expired":    t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt),
+		"lastUsedAt": t.LastUsedAt,
+		"createdAt":  t.CreatedAt,
+	}
+}
@@ -1,20 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"backend/internal/models"
+	"backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type SettingController struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Uploads *services.UploadService
 }
 
-func NewSettingController(db *gorm.DB) *SettingController {
-	return &SettingController{DB: db}
+func NewSettingController(db *gorm.DB, uploads *services.UploadService) *SettingController {
+	return &SettingController{DB: db, Uploads: uploads}
 }
 
 // GetUserSettings 获取用户设置
@@ -32,6 +36,7 @@ func (sc *SettingController) GetUserSettings(c *gin.Context) {
 			"fontSize":        14,
 			"backgroundImage": "",
 			"theme":           "light",
+			"timeZone":        "",
 		})
 		return
 	}
@@ -47,11 +52,12 @@ func (sc *SettingController) UpdateUserSettings(c *gin.Context) {
 		return
 	}
 
+	// 背景图片只能通过 UploadBackgroundImage 设置
 	var settingsInput struct {
-		FontFamily      string `json:"fontFamily"`
-		FontSize        int    `json:"fontSize"`
-		BackgroundImage string `json:"backgroundImage"`
-		Theme           string `json:"theme"`
+		FontFamily string `json:"fontFamily"`
+		FontSize   int    `json:"fontSize"`
+		Theme      string `json:"theme"`
+		TimeZone   string `json:"timeZone"` // IANA 时区名，不传则保持不变
 	}
 
 	if err := c.ShouldBindJSON(&settingsInput); err != nil {
@@ -59,15 +65,22 @@ func (sc *SettingController) UpdateUserSettings(c *gin.Context) {
 		return
 	}
 
+	if settingsInput.TimeZone != "" {
+		if _, err := time.LoadLocation(settingsInput.TimeZone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+			return
+		}
+	}
+
 	var settings models.UserSetting
 	if err := sc.DB.Where("user_id = ?", userID).First(&settings).Error; err != nil {
 		// 如果不存在则创建
 		settings = models.UserSetting{
-			UserID:          userID.(uint),
-			FontFamily:      settingsInput.FontFamily,
-			FontSize:        settingsInput.FontSize,
-			BackgroundImage: settingsInput.BackgroundImage,
-			Theme:           settingsInput.Theme,
+			UserID:     userID.(uint),
+			FontFamily: settingsInput.FontFamily,
+			FontSize:   settingsInput.FontSize,
+			Theme:      settingsInput.Theme,
+			TimeZone:   settingsInput.TimeZone,
 		}
 		if err := sc.DB.Create(&settings).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create settings"})
@@ -77,8 +90,10 @@ func (sc *SettingController) UpdateUserSettings(c *gin.Context) {
 		// 更新现有设置
 		settings.FontFamily = settingsInput.FontFamily
 		settings.FontSize = settingsInput.FontSize
-		settings.BackgroundImage = settingsInput.BackgroundImage
 		settings.Theme = settingsInput.Theme
+		if settingsInput.TimeZone != "" {
+			settings.TimeZone = settingsInput.TimeZone
+		}
 
 		if err := sc.DB.Save(&settings).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
@@ -103,30 +118,52 @@ func (sc *SettingController) UploadBackgroundImage(c *gin.Context) {
 		return
 	}
 
-	// 在实际应用中，应该将文件保存到安全的存储位置
-	filePath := "uploads/backgrounds/" + file.Filename
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	var settings models.UserSetting
+	found := sc.DB.Where("user_id = ?", userID).First(&settings).Error == nil
+	if err := sc.Uploads.CheckQuota(sc.DB, userID.(uint), file.Size, settings.BackgroundSize); err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	ctx := c.Request.Context()
+	// 缩小并重新压缩，同时去掉 EXIF 信息
+	key, size, err := sc.Uploads.SaveBackground(ctx, userID.(uint), file)
+	if err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"error": msg})
 		return
 	}
+	filePath := sc.Uploads.PublicURL(key)
 
 	// 更新用户设置中的背景图片路径
-	var settings models.UserSetting
-	if err := sc.DB.Where("user_id = ?", userID).First(&settings).Error; err != nil {
+	oldKey := ""
+	if !found {
 		settings = models.UserSetting{
 			UserID:          userID.(uint),
 			BackgroundImage: filePath,
-		}
-		if err := sc.DB.Create(&settings).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create settings"})
-			return
+			BackgroundSize:  size,
 		}
 	} else {
+		oldKey = sc.Uploads.KeyFromURL(settings.BackgroundImage, services.UploadBackground, userID.(uint))
 		settings.BackgroundImage = filePath
-		if err := sc.DB.Save(&settings).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		settings.BackgroundSize = size
+	}
+	err = sc.Uploads.CommitWithinQuota(sc.DB, userID.(uint), func(tx *gorm.DB) error {
+		return tx.Save(&settings).Error
+	})
+	if err != nil {
+		sc.Uploads.Remove(ctx, key)
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status, msg := uploadErrorStatus(err)
+			c.JSON(status, gin.H{"error": msg})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+	if oldKey != "" {
+		sc.Uploads.Remove(ctx, oldKey)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"backgroundImage": filePath})
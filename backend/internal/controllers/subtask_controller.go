@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SubtaskController struct {
+	DB *gorm.DB
+}
+
+func NewSubtaskController(db *gorm.DB) *SubtaskController {
+	return &SubtaskController{DB: db}
+}
+
+// 子任务按 sort_order 排序
+func orderSubtasks(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order asc, id asc")
+}
+
+// 查找当前用户的父任务
+func (sc *SubtaskController) findTask(c *gin.Context) (*models.Task, bool) {
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := sc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return nil, false
+	}
+	return &task, true
+}
+
+// 获取任务的子任务列表
+func (sc *SubtaskController) GetSubtasks(c *gin.Context) {
+	task, ok := sc.findTask(c)
+	if !ok {
+		return
+	}
+	var subtasks []models.Subtask
+	if err := orderSubtasks(sc.DB).Where("task_id = ?", task.ID).Find(&subtasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取子任务失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": subtasks})
+}
+
+// 添加子任务，排在最后
+func (sc *SubtaskController) CreateSubtask(c *gin.Context) {
+	task, ok := sc.findTask(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title     string `json:"title" binding:"required"`
+		Completed bool   `json:"completed"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	var maxOrder *int
+	sc.DB.Model(&models.Subtask{}).Where("task_id = ?", task.ID).Select("MAX(sort_order)").Scan(&maxOrder)
+	subtask := models.Subtask{
+		TaskID:    task.ID,
+		Title:     strings.TrimSpace(req.Title),
+		Completed: req.Completed,
+	}
+	if maxOrder != nil {
+		subtask.SortOrder = *maxOrder + 1
+	}
+	if err := sc.DB.Create(&subtask).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "创建子任务失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "创建成功", "data": subtask})
+}
+
+// 修改子任务标题或完成状态
+func (sc *SubtaskController) UpdateSubtask(c *gin.Context) {
+	task, ok := sc.findTask(c)
+	if !ok {
+		return
+	}
+	var subtask models.Subtask
+	if err := sc.DB.Where("id = ? AND task_id = ?", c.Param("subtaskId"), task.ID).First(&subtask).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "子任务不存在"})
+		return
+	}
+
+	var req struct {
+		Title     string `json:"title"`
+		Completed *bool  `json:"completed"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	if title := strings.TrimSpace(req.Title); title != "" {
+		subtask.Title = title
+	}
+	if req.Completed != nil {
+		subtask.Completed = *req.Completed
+	}
+	if err := sc.DB.Save(&subtask).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": subtask})
+}
+
+// 调整子任务顺序，按传入的 id 顺序重新编号
+func (sc *SubtaskController) ReorderSubtasks(c *gin.Context) {
+	task, ok := sc.findTask(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		IDs []uint `json:"ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	err := sc.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.IDs {
+			if err := tx.Model(&models.Subtask{}).Where("id = ? AND task_id = ?", id, task.ID).Update("sort_order", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "排序失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "排序成功"})
+}
+
+// 删除子任务
+func (sc *SubtaskController) DeleteSubtask(c *gin.Context) {
+	task, ok := sc.findTask(c)
+	if !ok {
+		return
+	}
+	result := sc.DB.Where("id = ? AND task_id = ?", c.Param("subtaskId"), task.ID).Delete(&models.Subtask{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"code": 1, "msg": "子任务不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已删除"})
+}
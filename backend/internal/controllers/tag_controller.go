@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TagController struct {
+	DB *gorm.DB
+}
+
+func NewTagController(db *gorm.DB) *TagController {
+	return &TagController{DB: db}
+}
+
+// tagNames 任务接口中的标签参数，兼容逗号分隔的字符串、名称数组和标签对象数组
+type tagNames []string
+
+func (t *tagNames) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = services.SplitTagNames(s)
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return errors.New("tags 格式错误")
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+		var tag struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &tag); err != nil {
+			return errors.New("tags 格式错误")
+		}
+		names = append(names, tag.Name)
+	}
+	*t = services.NormalizeTagNames(names)
+	return nil
+}
+
+// 获取标签列表（含未删除任务数）
+func (tc *TagController) GetTags(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	var tags []models.Tag
+	if err := tc.DB.Where("user_id = ?", userID).Order("name asc").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取标签失败"})
+		return
+	}
+
+	var counts []struct {
+		TagID uint
+		Total int64
+	}
+	if err := tc.DB.Table("task_tags").
+		Select("task_tags.tag_id AS tag_id, COUNT(*) AS total").
+		Joins("JOIN tasks ON tasks.id = task_tags.task_id").
+		Where("tasks.user_id = ? AND tasks.is_deleted = ? AND tasks.deleted_at IS NULL", userID, false).
+		Group("task_tags.tag_id").
+		Scan(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取标签失败"})
+		return
+	}
+	byTag := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		byTag[row.TagID] = row.Total
+	}
+	for i := range tags {
+		tags[i].TaskCount = byTag[tags[i].ID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tags})
+}
+
+// 创建标签
+func (tc *TagController) CreateTag(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	var input struct {
+		Name  string `json:"name" binding:"required,max=50"`
+		Color string `json:"color" binding:"max=20"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	names := services.NormalizeTagNames([]string{input.Name})
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "标签名不能为空"})
+		return
+	}
+
+	var count int64
+	tc.DB.Model(&models.Tag{}).Where("user_id = ? AND name = ?", userID, names[0]).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "标签已存在"})
+		return
+	}
+
+	tag := models.Tag{UserID: userID.(uint), Name: names[0], Color: input.Color}
+	if err := tc.DB.Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "创建标签失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "创建成功", "data": tag})
+}
+
+// 重命名或修改标签颜色
+func (tc *TagController) UpdateTag(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var tag models.Tag
+	if err := tc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&tag).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "标签不存在"})
+		return
+	}
+
+	var req struct {
+		Name  *string `json:"name" binding:"omitempty,max=50"`
+		Color *string `json:"color" binding:"omitempty,max=20"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+
+	if req.Name != nil {
+		names := services.NormalizeTagNames([]string{*req.Name})
+		if len(names) == 0 {
+			c.JSON(400, gin.H{"code": 1, "msg": "标签名不能为空"})
+			return
+		}
+		var count int64
+		tc.DB.Model(&models.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userID, names[0], tag.ID).Count(&count)
+		if count > 0 {
+			c.JSON(400, gin.H{"code": 1, "msg": "标签已存在，请使用合并"})
+			return
+		}
+		tag.Name = names[0]
+	}
+	if req.Color != nil {
+		tag.Color = *req.Color
+	}
+
+	if err := tc.DB.Save(&tag).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": tag})
+}
+
+// 将标签合并到另一个标签，原标签关联的任务转移到目标标签后删除原标签
+func (tc *TagController) MergeTag(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var source models.Tag
+	if err := tc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&source).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "标签不存在"})
+		return
+	}
+
+	var req struct {
+		TargetID uint `json:"targetId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	if req.TargetID == source.ID {
+		c.JSON(400, gin.H{"code": 1, "msg": "不能合并到自身"})
+		return
+	}
+	var target models.Tag
+	if err := tc.DB.Where("id = ? AND user_id = ?", req.TargetID, userID).First(&target).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "目标标签不存在"})
+		return
+	}
+
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(
+			"INSERT INTO task_tags (task_id, tag_id) SELECT task_id, ? FROM task_tags WHERE tag_id = ? AND task_id NOT IN (SELECT task_id FROM task_tags WHERE tag_id = ?)",
+			target.ID, source.ID, target.ID,
+		).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		// 重复任务模板上的标签同样合并
+		if err := tx.Exec(
+			"INSERT INTO task_series_tags (task_series_id, tag_id) SELECT task_series_id, ? FROM task_series_tags WHERE tag_id = ? AND task_series_id NOT IN (SELECT task_series_id FROM task_series_tags WHERE tag_id = ?)",
+			target.ID, source.ID, target.ID,
+		).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_series_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "合并失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "合并成功", "data": target})
+}
+
+// 删除标签（同时解除与任务的关联）
+func (tc *TagController) DeleteTag(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var tag models.Tag
+	if err := tc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&tag).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "标签不存在"})
+		return
+	}
+
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_series_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已删除"})
+}
@@ -5,17 +5,20 @@ import (
 	"time"
 
 	"backend/internal/models"
+	"backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type TaskController struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	TrashRetention time.Duration
+	Uploads        *services.UploadService
 }
 
-func NewTaskController(db *gorm.DB) *TaskController {
-	return &TaskController{DB: db}
+func NewTaskController(db *gorm.DB, trashRetention time.Duration, uploads *services.UploadService) *TaskController {
+	return &TaskController{DB: db, TrashRetention: trashRetention, Uploads: uploads}
 }
 
 // 获取任务列表
@@ -26,11 +29,106 @@ func (tc *TaskController) GetTasks(c *gin.Context) {
 		return
 	}
 
+	loc := services.UserLocation(tc.DB, userID.(uint))
+	var q taskListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	if err := q.normalize(loc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error()})
+		return
+	}
+
+	// 默认不返回回收站中的任务
+	query := q.filter(tc.DB.Model(&models.Task{}).Where("user_id = ?", userID))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取任务失败"})
+		return
+	}
+
 	var tasks []models.Task
-	if err := tc.DB.Where("user_id = ?", userID).Order("due_date asc").Find(&tasks).Error; err != nil {
+	var pageIDs []uint // 依赖排序分页时当前页任务的顺序
+	preloaded := func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Tags").Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks)
+	}
+	query = query.Order(q.orderBy())
+	if q.paged && q.Sort == "dependency" {
+		// 依赖排序需要看到全部结果：先只按 ID 排序分页，再加载当前页的任务
+		ids, err := services.DependencyPage(tc.DB, query.Session(&gorm.Session{}), userID.(uint), (q.Page-1)*q.PageSize, q.PageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取任务失败"})
+			return
+		}
+		pageIDs = ids
+		query = preloaded(tc.DB.Model(&models.Task{})).Where("id IN ?", ids)
+	} else {
+		query = preloaded(query)
+		if q.paged {
+			query = query.Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize)
+		}
+	}
+	if err := query.Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取任务失败"})
+		return
+	}
+	if err := services.LoadBlockers(tc.DB, tasks); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取任务失败"})
 		return
 	}
+	if pageIDs != nil {
+		tasks = orderTasksByID(tasks, pageIDs)
+	} else if q.Sort == "dependency" {
+		services.SortByDependencies(tasks)
+	}
+
+	decorateTasks(tasks, loc)
+	resp := gin.H{"code": 0, "msg": "success", "data": tasks, "total": total}
+	if q.paged {
+		resp["page"] = q.Page
+		resp["pageSize"] = q.PageSize
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// orderTasksByID 按 ids 的顺序排列任务
+func orderTasksByID(tasks []models.Task, ids []uint) []models.Task {
+	byID := make(map[uint]models.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	sorted := make([]models.Task, 0, len(tasks))
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			sorted = append(sorted, t)
+		}
+	}
+	return sorted
+}
+
+// 获取回收站中的任务
+func (tc *TaskController) GetTrash(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	var tasks []models.Task
+	if err := tc.DB.Preload("Tags").Preload("Category").Preload("Subtasks", orderSubtasks).Where("user_id = ? AND is_deleted = ?", userID, true).Order("trashed_at desc").Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取回收站失败"})
+		return
+	}
+
+	for i := range tasks {
+		if tasks[i].TrashedAt != nil {
+			purgeAt := tasks[i].TrashedAt.Add(tc.TrashRetention)
+			tasks[i].PurgeAt = &purgeAt
+		}
+	}
+	decorateTasks(tasks, services.UserLocation(tc.DB, userID.(uint)))
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": tasks})
 }
@@ -44,45 +142,106 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 	}
 
 	var input struct {
-		Title       string `json:"title" binding:"required"`
-		Description string `json:"description"`
-		DueDate     string `json:"dueDate" binding:"required"`
-		Category    string `json:"category"`
-		Tags        string `json:"tags"`
-		IsDeleted   bool   `json:"isDeleted"`
-		Completed   bool   `json:"completed"` // 新增
+		Title       string   `json:"title" binding:"required"`
+		Description string   `json:"description"`
+		DueDate     string   `json:"dueDate" binding:"required"` // 2006-01-02 表示全天，也可带时间
+		AllDay      bool     `json:"allDay"`
+		CategoryID  *uint    `json:"categoryId"`
+		Category    string   `json:"category"` // 分类名称，兼容旧版客户端
+		Tags        tagNames `json:"tags"`
+		IsDeleted   bool     `json:"isDeleted"`
+		Completed   bool     `json:"completed"` // 新增
+		Priority    int      `json:"priority"`
+		Status      string   `json:"status"`     // 初始状态，默认 todo
+		Recurrence  string   `json:"recurrence"` // 重复规则，如 FREQ=WEEKLY;BYDAY=MO,WE
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
 		return
 	}
 
-	// 只做格式校验，不需要用 due 变量
-	if _, err := time.Parse("2006-01-02", input.DueDate); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "截止日期格式错误"})
+	loc := services.UserLocation(tc.DB, userID.(uint))
+	dueDate, allDay, err := services.ParseDueDate(input.DueDate, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error()})
+		return
+	}
+	if input.AllDay && !allDay {
+		dueDate, allDay = services.StartOfDay(dueDate, loc), true
+	}
+
+	if !services.IsValidPriority(input.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "优先级错误"})
+		return
+	}
+	status := input.Status
+	if status == "" {
+		status = models.TaskStatusTodo
+		if input.Completed {
+			status = models.TaskStatusDone
+		}
+	}
+	if !services.IsValidTaskStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "任务状态错误"})
+		return
+	}
+
+	categoryID, err := services.ResolveCategoryID(tc.DB, userID.(uint), input.CategoryID, input.Category)
+	if err != nil {
+		status, msg := categoryErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
 		return
 	}
 
 	task := models.Task{
 		Title:       input.Title,
 		Description: input.Description,
-		DueDate:     input.DueDate,
-		Category:    input.Category,
-		Tags:        input.Tags,
+		DueDate:     &dueDate,
+		AllDay:      allDay,
+		CategoryID:  categoryID,
 		IsDeleted:   input.IsDeleted,
-		Completed:   input.Completed, // 新增
+		Completed:   status == models.TaskStatusDone,
+		Priority:    input.Priority,
+		Status:      status,
 		UserID:      userID.(uint),
 	}
+	if task.IsDeleted {
+		now := time.Now()
+		task.TrashedAt = &now
+	}
+	if input.Recurrence != "" {
+		if _, err := services.ParseRecurrenceRule(input.Recurrence, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+	}
 
-	if err := tc.DB.Create(&task).Error; err != nil {
+	err = tc.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := services.ResolveTags(tx, task.UserID, input.Tags)
+		if err != nil {
+			return err
+		}
+		task.Tags = tags
+		if err := tx.Omit("Tags.*").Create(&task).Error; err != nil {
+			return err
+		}
+		if input.Recurrence == "" {
+			return nil
+		}
+		return services.StartSeries(tx, &task, input.Recurrence, loc)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "创建任务失败"})
 		return
 	}
+	tc.DB.Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks).First(&task, task.ID)
+	decorateTask(&task, loc)
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "创建成功", "data": task})
 }
 
 // 更新任务（支持 tags 和 isDeleted 字段）
+// 重复任务可通过 ?scope=series 将修改同步到整个序列，默认只修改这一次
 func (tc *TaskController) UpdateTask(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	id := c.Param("id")
@@ -93,128 +252,413 @@ func (tc *TaskController) UpdateTask(c *gin.Context) {
 	}
 
 	var req struct {
-		Title       string `json:"title"`
-		DueDate     string `json:"dueDate"`
-		Description string `json:"description"`
-		Category    string `json:"category"`
-		Tags        string `json:"tags"`
-		IsDeleted   *bool  `json:"isDeleted"`
+		Title       string   `json:"title"`
+		DueDate     string   `json:"dueDate"`
+		AllDay      *bool    `json:"allDay"`
+		Description string   `json:"description"`
+		CategoryID  *uint    `json:"categoryId"` // 传 0 则清除分类
+		Category    string   `json:"category"`   // 分类名称，兼容旧版客户端
+		Tags        tagNames `json:"tags"`       // 不传则保持不变，传空列表则清空
+		IsDeleted   *bool    `json:"isDeleted"`
+		Completed   *bool    `json:"completed"` // 兼容旧版客户端，等同于切换 done / todo 状态
+		Priority    *int     `json:"priority"`
+		Status      string   `json:"status"`
+		Recurrence  *string  `json:"recurrence"` // 传空字符串则停止重复
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
 		return
 	}
+	scope := c.DefaultQuery("scope", "single")
+	if scope != "single" && scope != "series" {
+		c.JSON(400, gin.H{"code": 1, "msg": "scope 参数错误"})
+		return
+	}
 
 	if req.Title != "" {
 		task.Title = req.Title
 	}
+	loc := services.UserLocation(tc.DB, task.UserID)
+	dueChanged := false
 	if req.DueDate != "" {
-		task.DueDate = req.DueDate
+		dueDate, allDay, err := services.ParseDueDate(req.DueDate, loc)
+		if err != nil {
+			c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		task.DueDate, task.AllDay = &dueDate, allDay
+		dueChanged = true
+	}
+	if req.AllDay != nil && *req.AllDay != task.AllDay && task.DueDate != nil {
+		task.AllDay = *req.AllDay
+		if task.AllDay {
+			start := services.StartOfDay(*task.DueDate, loc)
+			task.DueDate = &start
+		}
 	}
 	if req.Description != "" {
 		task.Description = req.Description
 	}
-	if req.Category != "" {
-		task.Category = req.Category
+	if req.CategoryID != nil || req.Category != "" {
+		categoryID, err := services.ResolveCategoryID(tc.DB, task.UserID, req.CategoryID, req.Category)
+		if err != nil {
+			status, msg := categoryErrorStatus(err)
+			c.JSON(status, gin.H{"code": 1, "msg": msg})
+			return
+		}
+		task.CategoryID = categoryID
+	}
+	if req.Priority != nil {
+		if !services.IsValidPriority(*req.Priority) {
+			c.JSON(400, gin.H{"code": 1, "msg": "优先级错误"})
+			return
+		}
+		task.Priority = *req.Priority
+	}
+	status := req.Status
+	if status == "" && req.Completed != nil && *req.Completed != task.Completed {
+		status = models.TaskStatusTodo
+		if *req.Completed {
+			status = models.TaskStatusDone
+		}
 	}
-	task.Tags = req.Tags // 允许 tags 为空字符串
-	if req.IsDeleted != nil {
+	wasFinished := isFinished(task.Status)
+	if status != "" {
+		if status == models.TaskStatusDone && task.Status != models.TaskStatusDone && !tc.checkBlockers(c, &task) {
+			return
+		}
+		if err := services.ChangeTaskStatus(&task, status); err != nil {
+			c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+	}
+	if req.IsDeleted != nil && *req.IsDeleted != task.IsDeleted {
 		task.IsDeleted = *req.IsDeleted
+		if task.IsDeleted {
+			now := time.Now()
+			task.TrashedAt = &now
+		} else {
+			task.TrashedAt = nil
+		}
 	}
 
-	if err := tc.DB.Save(&task).Error; err != nil {
+	if req.Recurrence != nil && *req.Recurrence != "" {
+		if task.DueDate == nil {
+			c.JSON(400, gin.H{"code": 1, "msg": "重复任务必须设置截止日期"})
+			return
+		}
+		if _, err := services.ParseRecurrenceRule(*req.Recurrence, loc); err != nil {
+			c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+	}
+
+	var next *models.Task
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(&task).Error; err != nil {
+			return err
+		}
+		if req.Tags != nil {
+			tags, err := services.ResolveTags(tx, task.UserID, req.Tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&task).Omit("Tags.*").Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&task).Association("Tags").Find(&task.Tags); err != nil {
+			return err
+		}
+
+		switch {
+		case req.Recurrence != nil && task.SeriesID != nil:
+			if err := services.ChangeSeriesRule(tx, &task, *req.Recurrence, loc); err != nil {
+				return err
+			}
+		case req.Recurrence != nil && *req.Recurrence != "":
+			if err := services.StartSeries(tx, &task, *req.Recurrence, loc); err != nil {
+				return err
+			}
+		}
+		if scope == "series" && task.SeriesID != nil {
+			if err := services.UpdateSeriesTemplate(tx, &task, dueChanged); err != nil {
+				return err
+			}
+		}
+		if !wasFinished && isFinished(task.Status) {
+			var err error
+			if next, err = services.AdvanceSeries(tx, &task, loc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
 		return
 	}
-	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": task})
+	tc.DB.Preload("Tags").Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks).First(&task, task.ID)
+	decorateTask(&task, loc)
+	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": task, "next": tc.loadNext(next, loc)})
 }
 
-// 软删除任务（移入回收站）
-func (tc *TaskController) DeleteTask(c *gin.Context) {
+// 变更任务状态（按状态流转规则校验）
+func (tc *TaskController) UpdateTaskStatus(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	id := c.Param("id")
 	var task models.Task
-	if err := tc.DB.Where("id = ? AND user_id = ?", id, userID).First(&task).Error; err != nil {
+	if err := tc.DB.Preload("Tags").Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
 		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
 		return
 	}
-	task.IsDeleted = true
-	if err := tc.DB.Save(&task).Error; err != nil {
-		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
 		return
 	}
-	c.JSON(200, gin.H{"code": 0, "msg": "已移入回收站"})
-}
-
-// UploadTaskResource 上传任务相关资料
-func (tc *TaskController) UploadTaskResource(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	wasFinished := isFinished(task.Status)
+	if req.Status == models.TaskStatusDone && task.Status != models.TaskStatusDone && !tc.checkBlockers(c, &task) {
+		return
+	}
+	if err := services.ChangeTaskStatus(&task, req.Status); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
 		return
 	}
 
-	taskID := c.Param("id")
+	loc := services.UserLocation(tc.DB, task.UserID)
+	next, err := tc.saveStatus(&task, !wasFinished && isFinished(task.Status), loc)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
+		return
+	}
+	decorateTask(&task, loc)
+	c.JSON(200, gin.H{"code": 0, "msg": "更新成功", "data": task, "next": tc.loadNext(next, loc)})
+}
 
-	// 验证任务是否存在且属于该用户
+// 跳过重复任务的这一次，并生成下一次
+func (tc *TaskController) SkipOccurrence(c *gin.Context) {
+	userID, _ := c.Get("userID")
 	var task models.Task
-	if err := tc.DB.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if err := tc.DB.Preload("Tags").Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+	if task.SeriesID == nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "该任务不是重复任务"})
+		return
+	}
+	if isFinished(task.Status) {
+		c.JSON(400, gin.H{"code": 1, "msg": "该任务已结束"})
+		return
+	}
+	if err := services.ChangeTaskStatus(&task, models.TaskStatusCancelled); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": err.Error()})
 		return
 	}
 
-	file, err := c.FormFile("file")
+	loc := services.UserLocation(tc.DB, task.UserID)
+	next, err := tc.saveStatus(&task, true, loc)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		c.JSON(500, gin.H{"code": 1, "msg": "跳过失败"})
 		return
 	}
+	decorateTask(&task, loc)
+	c.JSON(200, gin.H{"code": 0, "msg": "已跳过", "data": task, "next": tc.loadNext(next, loc)})
+}
+
+// 完成任务前检查是否还有未结束的阻塞任务，有则返回 409 和阻塞列表；?force=true 时忽略
+func (tc *TaskController) checkBlockers(c *gin.Context, task *models.Task) bool {
+	if c.Query("force") == "true" {
+		return true
+	}
+	blockers, err := services.OpenBlockers(tc.DB, task.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "更新失败"})
+		return false
+	}
+	if len(blockers) > 0 {
+		c.JSON(409, gin.H{"code": 1, "msg": "任务仍被未完成的任务阻塞", "data": blockers})
+		return false
+	}
+	return true
+}
 
-	// 在实际应用中，应该将文件保存到安全的存储位置
-	filePath := "uploads/" + file.Filename
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+// 保存状态变更，advance 为 true 时为重复任务生成下一次
+func (tc *TaskController) saveStatus(task *models.Task, advance bool, loc *time.Location) (*models.Task, error) {
+	var next *models.Task
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(task).Updates(map[string]interface{}{"status": task.Status, "completed": task.Completed}).Error; err != nil {
+			return err
+		}
+		if !advance {
+			return nil
+		}
+		var err error
+		next, err = services.AdvanceSeries(tx, task, loc)
+		return err
+	})
+	return next, err
+}
+
+// 重新加载生成的下一次任务用于返回
+func (tc *TaskController) loadNext(next *models.Task, loc *time.Location) *models.Task {
+	if next == nil {
+		return nil
+	}
+	tc.DB.Preload("Tags").Preload("Category").Preload("Series").Preload("Subtasks", orderSubtasks).First(next, next.ID)
+	decorateTask(next, loc)
+	return next
+}
+
+// 软删除任务（移入回收站）
+func (tc *TaskController) DeleteTask(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	id := c.Param("id")
+	var task models.Task
+	if err := tc.DB.Where("id = ? AND user_id = ?", id, userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+	if !task.IsDeleted {
+		now := time.Now()
+		task.IsDeleted = true
+		task.TrashedAt = &now
+	}
+	if err := tc.DB.Save(&task).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
 		return
 	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已移入回收站"})
+}
 
-	resource := models.TaskResource{
-		TaskID:   task.ID,
-		FileName: file.Filename,
-		FilePath: filePath,
-		FileSize: file.Size,
+// 从回收站恢复任务
+func (tc *TaskController) RestoreTask(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	id := c.Param("id")
+	var task models.Task
+	if err := tc.DB.Where("id = ? AND user_id = ? AND is_deleted = ?", id, userID, true).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "回收站中不存在该任务"})
+		return
+	}
+	task.IsDeleted = false
+	task.TrashedAt = nil
+	if err := tc.DB.Save(&task).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "恢复失败"})
+		return
 	}
+	decorateTask(&task, services.UserLocation(tc.DB, task.UserID))
+	c.JSON(200, gin.H{"code": 0, "msg": "已恢复", "data": task})
+}
 
-	if err := tc.DB.Create(&resource).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save resource"})
+// 批量从回收站恢复任务
+func (tc *TaskController) RestoreTasks(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		IDs []uint `json:"ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, resource)
+	result := tc.DB.Model(&models.Task{}).
+		Where("id IN ? AND user_id = ? AND is_deleted = ?", req.IDs, userID, true).
+		Updates(map[string]interface{}{"is_deleted": false, "trashed_at": nil})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "恢复失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "已恢复", "data": gin.H{"restored": result.RowsAffected}})
 }
 
-// 彻底删除任务
+// 彻底删除任务（仅限回收站中的任务）
 func (tc *TaskController) RemoveTaskPermanently(c *gin.Context) {
 	userID, _ := c.Get("userID")
 	id := c.Param("id")
-	if err := tc.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Task{}).Error; err != nil {
+	var task models.Task
+	if err := tc.DB.Where("id = ? AND user_id = ?", id, userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+	if !task.IsDeleted {
+		c.JSON(400, gin.H{"code": 1, "msg": "请先将任务移入回收站"})
+		return
+	}
+	if err := services.PurgeTasks(tc.DB, tc.Uploads, []uint{task.ID}); err != nil {
 		c.JSON(500, gin.H{"code": 1, "msg": "彻底删除失败"})
 		return
 	}
 	c.JSON(200, gin.H{"code": 0, "msg": "已彻底删除"})
 }
 
-// 获取任务列表
-func (tc *TaskController) ListTasks(c *gin.Context) {
+// 清空回收站
+func (tc *TaskController) EmptyTrash(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	var tasks []models.Task
-	if err := tc.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&tasks).Error; err != nil {
-		c.JSON(500, gin.H{"code": 1, "msg": "获取失败"})
+	var ids []uint
+	if err := tc.DB.Model(&models.Task{}).Where("user_id = ? AND is_deleted = ?", userID, true).Pluck("id", &ids).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "清空回收站失败"})
 		return
 	}
-	c.JSON(200, gin.H{"code": 0, "data": tasks})
+	if err := services.PurgeTasks(tc.DB, tc.Uploads, ids); err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "清空回收站失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "回收站已清空", "data": gin.H{"removed": len(ids)}})
+}
+
+// 已完成或已取消的任务视为结束
+func isFinished(status string) bool {
+	return status == models.TaskStatusDone || status == models.TaskStatusCancelled
+}
+
+// getColorCode 根据任务状态和截止日期返回颜色代码
+func getColorCode(task *models.Task) string {
+	if isFinished(task.Status) {
+		return "#c8d6e5" // 灰色 - 已结束
+	}
+	if task.DueDate == nil {
+		return ""
+	}
+	// 全天任务在当天结束前都算未过期
+	return getColorCodeByDueDate(services.DueEnd(task))
+}
+
+// decorateTask 填充任务的计算字段（颜色代码、到期状态、完成进度）
+func decorateTask(task *models.Task, loc *time.Location) {
+	task.ColorCode = getColorCode(task)
+	task.DueState = services.DueState(task, time.Now(), loc)
+	task.Progress = getProgress(task)
+}
+
+// getProgress 按子任务完成情况计算进度百分比
+func getProgress(task *models.Task) int {
+	if len(task.Subtasks) == 0 {
+		if task.Status == models.TaskStatusDone {
+			return 100
+		}
+		return 0
+	}
+	done := 0
+	for _, s := range task.Subtasks {
+		if s.Completed {
+			done++
+		}
+	}
+	return done * 100 / len(task.Subtasks)
+}
+
+// decorateTasks 为任务列表填充计算字段
+func decorateTasks(tasks []models.Task, loc *time.Location) {
+	for i := range tasks {
+		decorateTask(&tasks[i], loc)
+	}
 }
 
 // getColorCodeByDueDate 根据截止日期返回颜色代码
-/*func getColorCodeByDueDate(dueDate time.Time) string {
+func getColorCodeByDueDate(dueDate time.Time) string {
 	now := time.Now()
 	diff := dueDate.Sub(now)
 
@@ -225,4 +669,4 @@ func (tc *TaskController) ListTasks(c *gin.Context) {
 	} else {
 		return "#1dd1a1" // 绿色 - 还有时间
 	}
-}*/
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+// 允许排序的字段，键为接口参数，值为排序表达式
+var taskSortFields = map[string]string{
+	"dueDate":   "due_date",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+	"title":     "title",
+	"priority":  "priority",
+	// 按工作流顺序而不是字母顺序排列状态
+	"status": "CASE status WHEN 'todo' THEN 0 WHEN 'in_progress' THEN 1 WHEN 'blocked' THEN 2 WHEN 'done' THEN 3 WHEN 'cancelled' THEN 4 ELSE 5 END",
+	// 阻塞者排在被阻塞的任务之前，其余按截止日期，见 GetTasks
+	"dependency": "due_date",
+}
+
+// taskListQuery 任务列表的查询参数
+type taskListQuery struct {
+	Status      string `form:"status"` // open / completed / trashed / all 或逗号分隔的任务状态，默认不含回收站
+	Priority    *int   `form:"priority"`
+	MinPriority *int   `form:"minPriority"`
+	CategoryID  uint   `form:"categoryId"`
+	Category    string `form:"category"` // 分类名称
+	Tag         string `form:"tag"`
+	DueFrom     string `form:"dueFrom"` // 截止日期下限（含），格式 2006-01-02，按用户时区
+	DueTo       string `form:"dueTo"`   // 截止日期上限（含），格式 2006-01-02，按用户时区
+	Due         string `form:"due"`     // overdue / today / week，按用户时区计算
+	Search      string `form:"q"`       // 在标题和描述中搜索
+	Sort        string `form:"sort"`
+	Order       string `form:"order"`
+	Page        int    `form:"page"` // 未传 page 和 pageSize 时返回全部结果
+	PageSize    int    `form:"pageSize"`
+
+	statuses []string // 从 Status 解析出的任务状态列表
+	paged    bool
+	loc      *time.Location
+	dueFrom  time.Time
+	dueTo    time.Time // 不含
+}
+
+// normalize 校验参数并补齐默认值，日期按 loc 时区解释
+func (q *taskListQuery) normalize(loc *time.Location) error {
+	q.loc = loc
+	switch q.Status {
+	case "", "open", "completed", "trashed", "all":
+	default:
+		for _, s := range strings.Split(q.Status, ",") {
+			s = strings.TrimSpace(s)
+			if !services.IsValidTaskStatus(s) {
+				return errors.New("status 参数错误")
+			}
+			q.statuses = append(q.statuses, s)
+		}
+	}
+	for _, p := range []*int{q.Priority, q.MinPriority} {
+		if p != nil && !services.IsValidPriority(*p) {
+			return errors.New("priority 参数错误")
+		}
+	}
+	if q.DueFrom != "" {
+		t, err := time.ParseInLocation("2006-01-02", q.DueFrom, loc)
+		if err != nil {
+			return errors.New("截止日期格式错误")
+		}
+		q.dueFrom = t
+	}
+	if q.DueTo != "" {
+		t, err := time.ParseInLocation("2006-01-02", q.DueTo, loc)
+		if err != nil {
+			return errors.New("截止日期格式错误")
+		}
+		q.dueTo = t.AddDate(0, 0, 1)
+	}
+	switch q.Due {
+	case "", "overdue", "today", "week":
+	default:
+		return errors.New("due 参数错误")
+	}
+	if q.Sort == "" {
+		q.Sort = "dueDate"
+	}
+	if _, ok := taskSortFields[q.Sort]; !ok {
+		return errors.New("sort 参数错误")
+	}
+	switch q.Order {
+	case "":
+		q.Order = "asc"
+	case "asc", "desc":
+	default:
+		return errors.New("order 参数错误")
+	}
+	q.paged = q.Page != 0 || q.PageSize != 0
+	if !q.paged {
+		return nil
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultTaskPageSize
+	}
+	if q.PageSize > maxTaskPageSize {
+		q.PageSize = maxTaskPageSize
+	}
+	return nil
+}
+
+// filter 在查询上追加筛选条件
+func (q *taskListQuery) filter(db *gorm.DB) *gorm.DB {
+	switch q.Status {
+	case "all":
+	case "trashed":
+		db = db.Where("is_deleted = ?", true)
+	case "open":
+		db = db.Where("is_deleted = ? AND status NOT IN ?", false,
+			[]string{models.TaskStatusDone, models.TaskStatusCancelled})
+	case "completed":
+		db = db.Where("is_deleted = ? AND completed = ?", false, true)
+	default:
+		db = db.Where("is_deleted = ?", false)
+		if len(q.statuses) > 0 {
+			db = db.Where("status IN ?", q.statuses)
+		}
+	}
+
+	if q.Priority != nil {
+		db = db.Where("priority = ?", *q.Priority)
+	}
+	if q.MinPriority != nil {
+		db = db.Where("priority >= ?", *q.MinPriority)
+	}
+
+	if q.CategoryID != 0 {
+		db = db.Where("category_id = ?", q.CategoryID)
+	} else if q.Category != "" {
+		db = db.Where("category_id IN (SELECT id FROM categories WHERE name = ?)", q.Category)
+	}
+	if q.Tag != "" {
+		db = db.Where("id IN (SELECT task_tags.task_id FROM task_tags JOIN tags ON tags.id = task_tags.tag_id WHERE tags.name = ?)", q.Tag)
+	}
+	if !q.dueFrom.IsZero() {
+		db = db.Where("due_date >= ?", q.dueFrom)
+	}
+	if !q.dueTo.IsZero() {
+		db = db.Where("due_date < ?", q.dueTo)
+	}
+	if q.Due != "" {
+		now := time.Now()
+		today := services.StartOfDay(now, q.loc)
+		ended := []string{models.TaskStatusDone, models.TaskStatusCancelled}
+		switch q.Due {
+		case "overdue":
+			// 全天任务到当天结束才算过期
+			db = db.Where("status NOT IN ? AND ((all_day = ? AND due_date < ?) OR (all_day = ? AND due_date < ?))",
+				ended, true, today, false, now)
+		case "today":
+			db = db.Where("due_date >= ? AND due_date < ?", today, today.AddDate(0, 0, 1))
+		case "week":
+			start := services.StartOfWeek(now, q.loc)
+			db = db.Where("due_date >= ? AND due_date < ?", start, start.AddDate(0, 0, 7))
+		}
+	}
+	if q.Search != "" {
+		like := "%" + escapeLike(q.Search) + "%"
+		db = db.Where(`(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, like, like)
+	}
+	return db
+}
+
+// escapeLike 转义 LIKE 中的通配符，SQL Server 中 [ 也是通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "[", `\[`).Replace(s)
+}
+
+// orderBy 返回排序子句，追加 id 保证分页结果稳定
+func (q *taskListQuery) orderBy() string {
+	return taskSortFields[q.Sort] + " " + q.Order + ", id " + q.Order
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 查找当前用户的任务及其附件，附件的归属通过任务校验
+func (tc *TaskController) findResource(c *gin.Context) (*models.TaskResource, bool) {
+	userID, _ := c.Get("userID")
+	var resource models.TaskResource
+	err := tc.DB.Joins("JOIN tasks ON tasks.id = task_resources.task_id").
+		Where("task_resources.id = ? AND task_resources.task_id = ? AND tasks.user_id = ?", c.Param("resourceId"), c.Param("id"), userID).
+		First(&resource).Error
+	if err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "附件不存在"})
+		return nil, false
+	}
+	return &resource, true
+}
+
+// UploadTaskResource 上传任务相关资料，支持一次上传多个文件（字段名 files 或 file）
+func (tc *TaskController) UploadTaskResource(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+
+	taskID := c.Param("id")
+
+	// 验证任务是否存在且属于该用户
+	var task models.Task
+	if err := tc.DB.Where("id = ? AND user_id = ? AND is_deleted = ?", taskID, userID, false).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "请选择要上传的文件"})
+		return
+	}
+	var files []*multipart.FileHeader
+	files = append(files, form.File["files"]...)
+	files = append(files, form.File["file"]...)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "请选择要上传的文件"})
+		return
+	}
+
+	var total int64
+	for _, file := range files {
+		if !validFileName(filepath.Base(file.Filename)) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "文件名不合法"})
+			return
+		}
+		total += file.Size
+	}
+	if err := tc.Uploads.CheckQuota(tc.DB, task.UserID, total, 0); err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+
+	blobs := make([]*services.PendingBlob, 0, len(files))
+	for _, file := range files {
+		blob, err := tc.Uploads.PrepareAttachment(file)
+		if err != nil {
+			status, msg := uploadErrorStatus(err)
+			c.JSON(status, gin.H{"code": 1, "msg": file.Filename + ": " + msg})
+			return
+		}
+		blobs = append(blobs, blob)
+	}
+
+	// 引用计数与附件记录在同一事务中提交
+	resources := make([]models.TaskResource, len(files))
+	err = tc.Uploads.CommitBlobs(c.Request.Context(), tc.DB, blobs, func() error {
+		return tc.Uploads.CommitWithinQuota(tc.DB, task.UserID, func(tx *gorm.DB) error {
+			for i, blob := range blobs {
+				if err := services.AcquireBlob(tx, blob); err != nil {
+					return err
+				}
+				resources[i] = models.TaskResource{
+					TaskID:      task.ID,
+					FileName:    filepath.Base(files[i].Filename),
+					FilePath:    blob.Key,
+					FileSize:    blob.Size,
+					ContentType: blob.ContentType,
+					BlobSHA256:  blob.SHA256,
+				}
+			}
+			return tx.Create(&resources).Error
+		})
+	})
+	if err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": 0, "msg": "上传成功", "data": resources})
+}
+
+// 获取任务的附件列表
+func (tc *TaskController) GetTaskResources(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := tc.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&task).Error; err != nil {
+		c.JSON(404, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+
+	var resources []models.TaskResource
+	if err := tc.DB.Where("task_id = ?", task.ID).Order("id asc").Find(&resources).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "获取附件失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "success", "data": resources})
+}
+
+// 下载附件
+func (tc *TaskController) DownloadTaskResource(c *gin.Context) {
+	resource, ok := tc.findResource(c)
+	if !ok {
+		return
+	}
+	serveStoredFile(c, tc.Uploads, resource.FilePath, resource.FileName, resource.ContentType)
+}
+
+// 重命名附件（只修改显示的文件名）
+func (tc *TaskController) RenameTaskResource(c *gin.Context) {
+	resource, ok := tc.findResource(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		FileName string `json:"fileName" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	name := strings.TrimSpace(req.FileName)
+	if !validFileName(name) {
+		c.JSON(400, gin.H{"code": 1, "msg": "文件名不合法"})
+		return
+	}
+	resource.FileName = name
+	if err := tc.DB.Save(resource).Error; err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "重命名失败"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 0, "msg": "重命名成功", "data": resource})
+}
+
+// 删除附件，存储中的文件没有其他附件引用时一并删除
+func (tc *TaskController) DeleteTaskResource(c *gin.Context) {
+	resource, ok := tc.findResource(c)
+	if !ok {
+		return
+	}
+	var removed []string
+	err := tc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(resource).Error; err != nil {
+			return err
+		}
+		var err error
+		removed, err = services.ReleaseResources(tx, []models.TaskResource{*resource})
+		return err
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"code": 1, "msg": "删除失败"})
+		return
+	}
+	tc.Uploads.RemoveFiles(c.Request.Context(), removed)
+	c.JSON(200, gin.H{"code": 0, "msg": "已删除"})
+}
+
+// validFileName 文件名不能包含路径分隔符和换行等控制字符，长度不超过数据库字段的 255 个字符
+func validFileName(name string) bool {
+	return name != "" && utf8.ValidString(name) && utf8.RuneCountInString(name) <= 255 &&
+		!strings.ContainsAny(name, `/\`) && strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// uploadErrorStatus 将上传错误转换为状态码和提示
+func uploadErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, services.ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType, err.Error()
+	case errors.Is(err, services.ErrInvalidImage):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage, err.Error()
+	case errors.Is(err, services.ErrTooManyUploads):
+		return http.StatusTooManyRequests, err.Error()
+	default:
+		return http.StatusInternalServerError, "保存文件失败"
+	}
+}
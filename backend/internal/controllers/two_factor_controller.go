@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type TwoFactorController struct {
+	DB        *gorm.DB
+	TwoFactor *services.TwoFactorService
+}
+
+func NewTwoFactorController(db *gorm.DB, twoFactor *services.TwoFactorService) *TwoFactorController {
+	return &TwoFactorController{DB: db, TwoFactor: twoFactor}
+}
+
+// GetStatus 两步验证是否开启及剩余的恢复码数量
+func (tc *TwoFactorController) GetStatus(c *gin.Context) {
+	user, ok := tc.currentUser(c)
+	if !ok {
+		return
+	}
+	remaining, err := tc.TwoFactor.RemainingRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取两步验证状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": gin.H{
+		"enabled":                user.TOTPEnabled,
+		"recoveryCodesRemaining": remaining,
+	}})
+}
+
+// Setup 生成密钥，客户端将 otpauthUrl 显示为二维码供验证器应用扫描；需要再次输入密码
+func (tc *TwoFactorController) Setup(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	user, ok := tc.currentUser(c)
+	if !ok || !checkPassword(c, user, input.Password) {
+		return
+	}
+
+	secret, uri, err := tc.TwoFactor.Setup(user)
+	if err != nil {
+		status, msg := twoFactorErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "success", "data": gin.H{
+		"secret":     secret,
+		"otpauthUrl": uri,
+	}})
+}
+
+// Enable 提交验证器应用中的第一个动态码开启两步验证，返回只显示一次的恢复码
+func (tc *TwoFactorController) Enable(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	user, ok := tc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := tc.TwoFactor.Enable(user, input.Code)
+	if err != nil {
+		status, msg := twoFactorErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "两步验证已开启，请妥善保存恢复码", "data": gin.H{
+		"recoveryCodes": codes,
+	}})
+}
+
+// Disable 关闭两步验证，需要密码和动态码（或恢复码）
+func (tc *TwoFactorController) Disable(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "参数错误"})
+		return
+	}
+	user, ok := tc.currentUser(c)
+	if !ok || !checkPassword(c, user, input.Password) {
+		return
+	}
+
+	if err := tc.TwoFactor.Disable(user, input.Code); err != nil {
+		status, msg := twoFactorErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "两步验证已关闭"})
+}
+
+func (tc *TwoFactorController) currentUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := tc.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "用户不存在"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkPassword 敏感操作前再次确认密码，不正确时写入响应并返回 false
+func checkPassword(c *gin.Context, user *models.User, password string) bool {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "密码错误"})
+		return false
+	}
+	return true
+}
+
+// twoFactorErrorStatus 将两步验证相关错误转换为状态码和提示
+func twoFactorErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrTwoFactorNotSetup):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, services.ErrTwoFactorEnabled), errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return http.StatusConflict, err.Error()
+	default:
+		return http.StatusInternalServerError, "处理两步验证失败"
+	}
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const tusVersion = "1.0.0"
+
+// UploadController 任务附件的断点续传，请求头与 tus 协议一致：
+// POST 创建（Upload-Length、Upload-Metadata），HEAD 查询 Upload-Offset，
+// PATCH 追加数据（Content-Type: application/offset+octet-stream），完成后调用 finish 保存为附件
+type UploadController struct {
+	DB        *gorm.DB
+	Resumable *services.ResumableUploads
+}
+
+func NewUploadController(db *gorm.DB, resumable *services.ResumableUploads) *UploadController {
+	return &UploadController{DB: db, Resumable: resumable}
+}
+
+// CreateUpload 创建断点续传上传，返回的 Location 用于后续请求
+func (uc *UploadController) CreateUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	userID, _ := c.Get("userID")
+	var task models.Task
+	if err := uc.DB.Where("id = ? AND user_id = ? AND is_deleted = ?", c.Param("id"), userID, false).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "任务不存在"})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "Upload-Length 参数错误"})
+		return
+	}
+	meta := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	name := meta["filename"]
+	if name == "" {
+		name = meta["name"]
+	}
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "缺少文件名"})
+		return
+	}
+	if !validFileName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "文件名不合法"})
+		return
+	}
+
+	session, err := uc.Resumable.Create(uc.DB, task.UserID, task.ID, name, length)
+	if err != nil {
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, gin.H{"code": 0, "msg": "创建成功", "data": session})
+}
+
+// GetUploadOffset 查询已接收的字节数，用于中断后继续上传
+func (uc *UploadController) GetUploadOffset(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	session, ok := uc.findUpload(c)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(session.UploadOffset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.UploadLength, 10))
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload 从 Upload-Offset 处追加一块数据
+func (uc *UploadController) PatchUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	session, ok := uc.findUpload(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "上传不存在"})
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": 1, "msg": "Content-Type 必须为 application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "msg": "Upload-Offset 参数错误"})
+		return
+	}
+	if c.Request.ContentLength > session.UploadLength-offset {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 1, "msg": "数据超出文件大小"})
+		return
+	}
+
+	newOffset, err := uc.Resumable.Append(uc.DB, session, offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	switch {
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "msg": err.Error()})
+	case errors.Is(err, services.ErrUploadLocked):
+		c.JSON(http.StatusLocked, gin.H{"code": 1, "msg": err.Error()})
+	case err != nil:
+		// 已写入的部分仍然有效，客户端可以查询偏移量后继续
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "接收数据失败"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// FinishUpload 全部数据接收后保存为任务附件
+func (uc *UploadController) FinishUpload(c *gin.Context) {
+	session, ok := uc.findUpload(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "上传不存在"})
+		return
+	}
+	resource, err := uc.Resumable.Finish(c.Request.Context(), uc.DB, session)
+	switch {
+	case errors.Is(err, services.ErrUploadIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"code": 1, "msg": err.Error()})
+	case errors.Is(err, services.ErrUploadLocked):
+		c.JSON(http.StatusLocked, gin.H{"code": 1, "msg": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "附件不存在"})
+	case err != nil:
+		status, msg := uploadErrorStatus(err)
+		c.JSON(status, gin.H{"code": 1, "msg": msg})
+	default:
+		c.JSON(http.StatusCreated, gin.H{"code": 0, "msg": "上传成功", "data": resource})
+	}
+}
+
+// AbortUpload 取消上传
+func (uc *UploadController) AbortUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	session, ok := uc.findUpload(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "上传不存在"})
+		return
+	}
+	if err := uc.Resumable.Abort(uc.DB, session); err != nil {
+		if errors.Is(err, services.ErrUploadLocked) {
+			c.JSON(http.StatusLocked, gin.H{"code": 1, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "取消上传失败"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// 查找当前用户在未删除任务下的上传
+func (uc *UploadController) findUpload(c *gin.Context) (*models.UploadSession, bool) {
+	userID, _ := c.Get("userID")
+	var session models.UploadSession
+	err := uc.DB.Joins("JOIN tasks ON tasks.id = upload_sessions.task_id").
+		Where("upload_sessions.id = ? AND upload_sessions.task_id = ? AND upload_sessions.user_id = ? AND tasks.is_deleted = ?",
+			c.Param("uploadId"), c.Param("id"), userID, false).
+		First(&session).Error
+	if err != nil {
+		return nil, false
+	}
+	return &session, true
+}
+
+// parseUploadMetadata 解析 tus 的 Upload-Metadata：逗号分隔的 "键 base64值"
+func parseUploadMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
@@ -3,16 +3,19 @@ package controllers
 import (
 	"net/http"
 
+	"backend/internal/services"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type UserController struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Uploads *services.UploadService
 }
 
-func NewUserController(db *gorm.DB) *UserController {
-	return &UserController{DB: db}
+func NewUserController(db *gorm.DB, uploads *services.UploadService) *UserController {
+	return &UserController{DB: db, Uploads: uploads}
 }
 
 // 用户信息接口示例
@@ -24,15 +27,51 @@ func (uc *UserController) Profile(c *gin.Context) {
 	}
 	// 假设有 User 模型
 	var user struct {
-		ID        uint
-		Username  string
-		Nickname  string
-		Email     string
-		AvatarURL string
+		ID            uint
+		Username      string
+		Nickname      string
+		Email         string
+		EmailVerified bool
+		PendingEmail  string // 等待验证的新邮箱
+		TOTPEnabled   bool   // 是否开启两步验证
+		AvatarURL     string
+		AvatarURLs    map[string]string `gorm:"-"` // 各尺寸头像地址
 	}
 	if err := uc.DB.Table("users").Where("id = ?", userID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "用户不存在"})
 		return
 	}
+	user.AvatarURLs = services.AvatarURLs(user.AvatarURL)
 	c.JSON(http.StatusOK, gin.H{"code": 0, "data": user})
 }
+
+// StorageUsage 查询当前用户的存储用量和配额（字节），quota 为 0 表示不限制
+func (uc *UserController) StorageUsage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "未授权"})
+		return
+	}
+	quota, err := uc.Uploads.UserQuota(uc.DB, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "msg": "用户不存在"})
+		return
+	}
+	usage, err := services.GetStorageUsage(uc.DB, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "msg": "获取存储用量失败"})
+		return
+	}
+	used := usage.Total()
+	var remaining int64
+	if quota > 0 && quota > used {
+		remaining = quota - used
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+		"quota":     quota,
+		"used":      used,
+		"remaining": remaining,
+		"unlimited": quota <= 0,
+		"byKind":    usage,
+	}})
+}
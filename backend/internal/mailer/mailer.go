@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/config"
+)
+
+// Message 纯文本邮件
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender 邮件发送方式
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New 按配置创建邮件发送方式，未配置 SMTP 时只把邮件写入日志，便于本地开发
+func New(cfg *config.Config) (Sender, error) {
+	if cfg.SMTPHost == "" {
+		return LogSender{}, nil
+	}
+	switch cfg.SMTPTLS {
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("未知的 SMTP_TLS 配置: %s", cfg.SMTPTLS)
+	}
+	return &SMTP{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		TLS:      cfg.SMTPTLS,
+		Timeout:  10 * time.Second,
+	}, nil
+}
+
+// LogSender 把邮件内容打印到日志
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("邮件（未配置 SMTP，未实际发送）收件人: %v 主题: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
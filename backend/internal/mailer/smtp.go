@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("邮件地址或主题不合法")
+
+// SMTP 通过 SMTP 服务器发送邮件。TLS 为 starttls（连接后升级，必须支持）、tls（直接 TLS，一般为 465 端口）或 none
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string // 为空时不认证
+	Password string
+	From     string
+	TLS      string
+	Timeout  time.Duration
+
+	TLSConfig *tls.Config // 为空时按 Host 校验服务器证书
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("缺少收件人")
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return ErrInvalidHeader
+	}
+	to := make([]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return ErrInvalidHeader
+		}
+		to = append(to, a.Address)
+	}
+	data, err := buildMessage(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *SMTP) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{Timeout: s.Timeout}
+	var conn net.Conn
+	var err error
+	if s.TLS == "tls" {
+		td := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}
+		conn, err = td.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 整个会话共用一个超时，避免服务器无响应时一直占用连接
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+func (s *SMTP) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig.Clone()
+	}
+	return &tls.Config{ServerName: s.Host}
+}
+
+// buildMessage 生成邮件内容，主题按 RFC 2047 编码，正文 base64 编码
+func buildMessage(from *mail.Address, to []string, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes(), nil
+}
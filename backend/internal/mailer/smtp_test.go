@@ -0,0 +1,287 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP 只实现发送邮件用到的命令，记录收到的内容
+type fakeSMTP struct {
+	ln       net.Listener
+	tlsConf  *tls.Config // 为空时不支持 STARTTLS
+	username string
+	password string
+
+	mu       sync.Mutex
+	usedTLS  bool
+	authed   bool
+	from     string
+	rcpts    []string
+	data     string
+	received chan struct{}
+}
+
+func newFakeSMTP(t *testing.T, tlsConf *tls.Config, username, password string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSMTP{ln: ln, tlsConf: tlsConf, username: username, password: password, received: make(chan struct{}, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) port() int {
+	return f.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+	encrypted := false
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-fake")
+			if f.tlsConf != nil && !encrypted {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case cmd == "STARTTLS":
+			if f.tlsConf == nil {
+				reply("502 not supported")
+				continue
+			}
+			reply("220 ready")
+			tlsConn := tls.Server(conn, f.tlsConf)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, encrypted = tlsConn, bufio.NewReader(tlsConn), true
+			f.mu.Lock()
+			f.usedTLS = true
+			f.mu.Unlock()
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			want := base64.StdEncoding.EncodeToString([]byte("\x00" + f.username + "\x00" + f.password))
+			if strings.TrimSpace(line[len("AUTH PLAIN"):]) != want {
+				reply("535 authentication failed")
+				continue
+			}
+			f.mu.Lock()
+			f.authed = true
+			f.mu.Unlock()
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			f.mu.Lock()
+			f.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			f.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			f.mu.Lock()
+			f.rcpts = append(f.rcpts, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			f.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(strings.TrimPrefix(l, "."))
+			}
+			f.mu.Lock()
+			f.data = b.String()
+			f.mu.Unlock()
+			f.received <- struct{}{}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("500 unknown command")
+		}
+	}
+}
+
+// selfSignedTLS 生成 127.0.0.1 的自签名证书，返回服务端配置和信任该证书的客户端配置
+func selfSignedTLS(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	return server, client
+}
+
+func TestSMTPSend(t *testing.T) {
+	serverTLS, clientTLS := selfSignedTLS(t)
+	tests := []struct {
+		name      string
+		serverTLS *tls.Config
+		mode      string
+		username  string
+		wantErr   bool
+	}{
+		{name: "starttls 并认证", serverTLS: serverTLS, mode: "starttls", username: "alice"},
+		{name: "starttls 不认证", serverTLS: serverTLS, mode: "starttls"},
+		{name: "服务器不支持 starttls", mode: "starttls", wantErr: true},
+		{name: "none 并认证", mode: "none", username: "alice"},
+		{name: "none 不认证", mode: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTP(t, tt.serverTLS, "alice", "s3cret")
+			s := &SMTP{
+				Host:      "127.0.0.1",
+				Port:      srv.port(),
+				Username:  tt.username,
+				Password:  "s3cret",
+				From:      "待办 <noreply@example.com>",
+				TLS:       tt.mode,
+				Timeout:   5 * time.Second,
+				TLSConfig: clientTLS,
+			}
+			msg := Message{
+				To:      []string{"Bob <bob@example.com>", "carol@example.com"},
+				Subject: "重置密码",
+				Body:    strings.Repeat("点击下面的链接设置新密码。\n", 10),
+			}
+			err := s.Send(context.Background(), msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("期望返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			<-srv.received
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.usedTLS != (tt.mode == "starttls") {
+				t.Errorf("usedTLS = %v", srv.usedTLS)
+			}
+			if srv.authed != (tt.username != "") {
+				t.Errorf("authed = %v", srv.authed)
+			}
+			if srv.from != "noreply@example.com" {
+				t.Errorf("MAIL FROM = %q", srv.from)
+			}
+			if strings.Join(srv.rcpts, ",") != "bob@example.com,carol@example.com" {
+				t.Errorf("RCPT TO = %v", srv.rcpts)
+			}
+
+			parsed, err := mail.ReadMessage(strings.NewReader(srv.data))
+			if err != nil {
+				t.Fatalf("解析邮件失败: %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != msg.Subject {
+				t.Errorf("Subject = %q, %v", subject, err)
+			}
+			if got := parsed.Header.Get("Content-Transfer-Encoding"); got != "base64" {
+				t.Errorf("Content-Transfer-Encoding = %q", got)
+			}
+			raw, _ := io.ReadAll(parsed.Body)
+			for _, l := range strings.Split(strings.TrimRight(string(raw), "\r\n"), "\r\n") {
+				if len(l) > 76 {
+					t.Errorf("正文行超过 76 个字符: %d", len(l))
+				}
+			}
+			body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+			if err != nil || string(body) != msg.Body {
+				t.Errorf("正文解码结果不一致: %v", err)
+			}
+		})
+	}
+}
+
+func TestSMTPAuthRejected(t *testing.T) {
+	srv := newFakeSMTP(t, nil, "alice", "s3cret")
+	s := &SMTP{Host: "127.0.0.1", Port: srv.port(), Username: "alice", Password: "wrong",
+		From: "noreply@example.com", TLS: "none", Timeout: 5 * time.Second}
+	err := s.Send(context.Background(), Message{To: []string{"bob@example.com"}, Subject: "hi", Body: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Fatalf("err = %v, 期望认证失败", err)
+	}
+}
+
+func TestBuildMessageRejectsHeaderInjection(t *testing.T) {
+	from := &mail.Address{Address: "noreply@example.com"}
+	for _, subject := range []string{"hi\r\nBcc: x@example.com", "hi\nBcc: x@example.com"} {
+		_, err := buildMessage(from, []string{"bob@example.com"}, Message{Subject: subject, Body: "hi"})
+		if !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("subject %q: err = %v", subject, err)
+		}
+	}
+	s := &SMTP{Host: "127.0.0.1", Port: 1, From: "noreply@example.com", TLS: "none", Timeout: time.Second}
+	err := s.Send(context.Background(), Message{To: []string{"bob@example.com\r\nBcc: x@example.com"}, Subject: "hi"})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("收件人含换行: err = %v", err)
+	}
+}
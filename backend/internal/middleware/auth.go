@@ -4,11 +4,14 @@ import (
 	"net/http"
 	"strings"
 
+	"backend/internal/services"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-func JWTAuth(secret string) gin.HandlerFunc {
+// JWTAuth 校验访问令牌，会话已注销的令牌同样拒绝。
+// 传入 scopes 时也接受拥有这些权限的个人访问令牌，不传时只接受登录会话
+func JWTAuth(sessions *services.SessionService, tokens *services.PersonalTokenService, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -18,27 +21,37 @@ func JWTAuth(secret string) gin.HandlerFunc {
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "无效token"})
-			c.Abort()
-			return
-		}
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "无效token"})
-			c.Abort()
+		if strings.HasPrefix(tokenString, services.PersonalTokenPrefix) {
+			token, err := tokens.Authenticate(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": err.Error()})
+				c.Abort()
+				return
+			}
+			if len(scopes) == 0 {
+				c.JSON(http.StatusForbidden, gin.H{"code": 1, "msg": "该接口不能使用个人访问令牌"})
+				c.Abort()
+				return
+			}
+			if !services.HasScopes(token, scopes...) {
+				c.JSON(http.StatusForbidden, gin.H{"code": 1, "msg": "访问令牌缺少权限: " + strings.Join(scopes, " ")})
+				c.Abort()
+				return
+			}
+			c.Set("userID", token.UserID)
+			c.Set("tokenID", token.ID)
+			c.Next()
 			return
 		}
-		userID, ok := claims["userID"].(float64)
-		if !ok {
+
+		userID, sessionID, err := sessions.Authenticate(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"code": 1, "msg": "无效token"})
 			c.Abort()
 			return
 		}
-		c.Set("userID", uint(userID))
+		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
 		c.Next()
 	}
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -8,30 +10,269 @@ type User struct {
 	ID        uint   `gorm:"primaryKey"`
 	Username  string `gorm:"unique;not null"`
 	Password  string `gorm:"not null"`
-	Nickname  string `gorm:"size:100"` // 新增昵称字段
-	Email     string `gorm:"size:100"` // 不加not null
+	Nickname  string `gorm:"size:100"`                                                               // 新增昵称字段
+	Email     string `gorm:"size:100;uniqueIndex:idx_users_verified_email,where:email_verified = 1"` // 不加not null
 	AvatarURL string `gorm:"size:255"`
+
+	EmailVerified bool   `gorm:"not null;default:false"` // 已验证的邮箱不能重复，见 Email 上的筛选唯一索引
+	PendingEmail  string `gorm:"size:100"`               // 修改邮箱时待验证的新地址，验证后才替换 Email
+
+	AvatarSize     int64 // 各尺寸头像文件的总大小，计入存储用量
+	StorageQuotaMB *int  // 单独设置的存储配额，为空时使用全局配置
+
+	// 两步验证：TOTPSecret 在开启前保存待确认的密钥，TOTPEnabled 为 true 时登录需要动态码
+	TOTPSecret   string `gorm:"size:64"`
+	TOTPEnabled  bool   `gorm:"not null;default:false"`
+	TOTPLastStep int64  // 最后一次使用的动态码时间片，同一动态码不能重复使用
+}
+
+// Session 一次登录，访问令牌通过 sid 关联；撤销后访问令牌和刷新令牌都失效
+type Session struct {
+	ID         string `gorm:"primaryKey;size:32"`
+	UserID     uint   `gorm:"not null;index"`
+	UserAgent  string `gorm:"size:255"`
+	IP         string `gorm:"size:64"`
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// RefreshToken 刷新令牌，只保存哈希；每次刷新都会轮换，同一会话的令牌构成一个令牌族
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID string `gorm:"size:32;not null;index"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time // 已换取新令牌，再次使用说明令牌泄露
+	CreatedAt time.Time
+}
+
+// PasswordReset 找回密码的一次性令牌，只保存哈希
+type PasswordReset struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RecoveryCode 两步验证的恢复码，每个只能使用一次，重新开启两步验证时全部作废
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
 
+// TwoFactorChallenge 密码验证通过后等待输入动态码的登录，TokenHash 为返回给客户端的令牌哈希
+type TwoFactorChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	Attempts  int    `gorm:"not null;default:0"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// UserIdentity 外部身份（OpenID Connect 的 iss + sub）与本地用户的关联
+type UserIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	Issuer    string `gorm:"size:191;not null;uniqueIndex:idx_identity_subject"`
+	Subject   string `gorm:"size:191;not null;uniqueIndex:idx_identity_subject"`
+	Email     string `gorm:"size:100"` // 关联时外部身份的邮箱，仅供展示
+	CreatedAt time.Time
+}
+
+// OIDCLogin 进行中的 OpenID Connect 登录，按 state 保存 nonce 和 PKCE 的 code_verifier，使用一次后删除
+type OIDCLogin struct {
+	StateHash    string `gorm:"primaryKey;size:64"`
+	Nonce        string `gorm:"size:64;not null"`
+	CodeVerifier string `gorm:"size:64;not null"`
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// PersonalAccessToken 个人访问令牌，供脚本调用接口；只保存哈希，Prefix 为令牌开头几位，便于用户辨认
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey"`
+	UserID     uint       `gorm:"not null;index"`
+	Name       string     `gorm:"size:100;not null"`
+	Prefix     string     `gorm:"size:16"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex"`
+	Scopes     string     `gorm:"size:255"` // 空格分隔的权限
+	ExpiresAt  *time.Time // 为空表示不过期
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// LoginThrottle 登录失败计数，ThrottleKey 为 user:<用户名> 或 ip:<地址>
+type LoginThrottle struct {
+	ThrottleKey   string `gorm:"primaryKey;size:191"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// AuditLog 安全相关事件的审计记录
+type AuditLog struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    *uint  `gorm:"index"` // 事件不对应已知用户时为空
+	Event     string `gorm:"size:50;not null;index"`
+	Subject   string `gorm:"size:191"` // 事件针对的对象，如用户名或 IP
+	IP        string `gorm:"size:64"`
+	Detail    string `gorm:"size:255"`
+	CreatedAt time.Time
+}
+
+// 任务优先级
+const (
+	PriorityNone   = 0
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+	PriorityUrgent = 4
+)
+
+// 任务状态
+const (
+	TaskStatusTodo       = "todo"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusBlocked    = "blocked"
+	TaskStatusDone       = "done"
+	TaskStatusCancelled  = "cancelled"
+)
+
 type Task struct {
 	gorm.Model
-	Title       string `json:"title"`
-	DueDate     string `json:"dueDate"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
-	Tags        string `json:"tags"`      // 用逗号分隔的标签
-	IsDeleted   bool   `json:"isDeleted"` // 软删除标记
-	Completed   bool   `json:"completed"` // 新增：任务完成状态
-	UserID      uint   `json:"userId"`
+	Title       string     `json:"title"`
+	DueDate     *time.Time `gorm:"index" json:"dueDate"`
+	AllDay      bool       `gorm:"default:false" json:"allDay"` // 全天任务，DueDate 为用户时区当天零点
+	Description string     `json:"description"`
+	CategoryID  *uint      `gorm:"index" json:"categoryId"`
+	Category    *Category  `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Tags        []Tag      `gorm:"many2many:task_tags" json:"tags"`
+	IsDeleted   bool       `json:"isDeleted"`                  // 软删除标记
+	TrashedAt   *time.Time `json:"trashedAt"`                  // 移入回收站的时间
+	PurgeAt     *time.Time `gorm:"-" json:"purgeAt,omitempty"` // 预计被自动清理的时间，仅回收站列表返回
+	Completed   bool       `json:"completed"`                  // 新增：任务完成状态，与 Status 为 done 保持一致
+	Priority    int        `gorm:"default:0" json:"priority"`
+	Status      string     `gorm:"size:20;default:'todo';index" json:"status"`
+	ColorCode   string     `gorm:"-" json:"colorCode"` // 根据截止日期和状态计算的紧急程度颜色
+	DueState    string     `gorm:"-" json:"dueState"`  // 按用户时区计算的到期状态：overdue / today / week / later
+	UserID      uint       `json:"userId"`
+
+	// 重复任务：每次只存在一个未完成的实例，完成或跳过后按 Series 的规则生成下一次
+	SeriesID     *uint       `gorm:"index" json:"seriesId"`
+	Series       *TaskSeries `gorm:"foreignKey:SeriesID" json:"series,omitempty"`
+	OccurrenceAt *time.Time  `json:"occurrenceAt"` // 按规则计划的发生时间，单独修改本次截止日期不影响它
+
+	Subtasks []Subtask `gorm:"foreignKey:TaskID" json:"subtasks"`
+	Progress int       `gorm:"-" json:"progress"` // 子任务完成百分比，没有子任务时按任务自身是否完成计算
+
+	BlockedBy []uint `gorm:"-" json:"blockedBy"` // 阻塞本任务的任务 id，仅任务列表返回
+}
+
+// TaskDependency 任务依赖：TaskID 被 BlockerID 阻塞，BlockerID 完成前 TaskID 不能完成
+type TaskDependency struct {
+	TaskID    uint      `gorm:"primaryKey;autoIncrement:false" json:"taskId"`
+	BlockerID uint      `gorm:"primaryKey;autoIncrement:false;index" json:"blockerId"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
+// Subtask 任务下的子任务 / 检查项，随父任务一起移入回收站和删除
+type Subtask struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    uint      `gorm:"not null;index" json:"taskId"`
+	Title     string    `gorm:"size:255;not null" json:"title"`
+	Completed bool      `gorm:"default:false" json:"completed"`
+	SortOrder int       `gorm:"default:0" json:"sortOrder"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TaskSeries 重复任务的规则和模板，生成新实例时使用这里的内容
+type TaskSeries struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"not null;index" json:"-"`
+	Rule             string    `gorm:"size:255;not null" json:"rule"` // RRULE 子集，例如 FREQ=WEEKLY;BYDAY=MO,WE
+	StartAt          time.Time `json:"startAt"`                       // 第一次发生时间
+	AllDay           bool      `json:"allDay"`
+	Title            string    `json:"-"`
+	Description      string    `json:"-"`
+	Priority         int       `json:"-"`
+	CategoryID       *uint     `json:"-"`
+	Tags             []Tag     `gorm:"many2many:task_series_tags" json:"-"`
+	Occurrences      int       `json:"occurrences"` // 已生成的实例数
+	LastOccurrenceAt time.Time `json:"lastOccurrenceAt"`
+	Ended            bool      `json:"ended"` // 已达到 UNTIL / COUNT 或被手动停止
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// Tag 用户自定义标签，通过 task_tags 关联任务
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"-"`
+	Name      string    `gorm:"size:50;not null;uniqueIndex:idx_tags_user_name" json:"name"`
+	Color     string    `gorm:"size:20" json:"color"`
+	TaskCount int64     `gorm:"-" json:"taskCount,omitempty"` // 关联的任务数，仅标签列表返回
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Category 用户的任务分类（项目）
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_categories_user_name" json:"-"`
+	Name      string    `gorm:"size:50;not null;uniqueIndex:idx_categories_user_name" json:"name"`
+	Color     string    `gorm:"size:20" json:"color"`
+	Icon      string    `gorm:"size:50" json:"icon"`
+	SortOrder int       `gorm:"default:0" json:"sortOrder"`
+	Archived  bool      `gorm:"default:false" json:"archived"`
+	TaskCount int64     `gorm:"-" json:"taskCount,omitempty"` // 关联的任务数，仅分类列表返回
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TaskResource 任务附件
 type TaskResource struct {
 	gorm.Model
-	TaskID   uint   `gorm:"not null"`
-	FileName string `gorm:"size:255;not null"`
-	FilePath string `gorm:"size:255;not null"`
-	FileSize int64  `gorm:"not null"`
-	Task     Task   `gorm:"foreignKey:TaskID"`
+	TaskID      uint   `gorm:"not null;index" json:"taskId"`
+	FileName    string `gorm:"size:255;not null" json:"fileName"`
+	FilePath    string `gorm:"size:255;not null" json:"-"`
+	FileSize    int64  `gorm:"not null" json:"fileSize"`
+	ContentType string `gorm:"size:100" json:"contentType"`
+	BlobSHA256  string `gorm:"size:64;index" json:"sha256,omitempty"` // 为空表示单独保存的旧文件
+	Task        Task   `gorm:"foreignKey:TaskID" json:"-"`
+}
+
+// Blob 按 SHA-256 保存的附件内容，相同内容只保存一份，RefCount 为引用它的附件数量
+type Blob struct {
+	SHA256      string `gorm:"primaryKey;size:64"`
+	Key         string `gorm:"size:255;not null"`
+	Size        int64  `gorm:"not null"`
+	ContentType string `gorm:"size:100"`
+	RefCount    int    `gorm:"not null;default:0"`
+	CreatedAt   time.Time
+}
+
+// UploadSession 断点续传的上传，数据先写入临时文件，完成后保存为任务附件
+type UploadSession struct {
+	ID           string    `gorm:"primaryKey;size:32" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"-"`
+	TaskID       uint      `gorm:"not null;index" json:"taskId"`
+	FileName     string    `gorm:"size:255;not null" json:"fileName"`
+	UploadLength int64     `gorm:"not null" json:"uploadLength"`
+	UploadOffset int64     `gorm:"not null;default:0" json:"uploadOffset"`
+	ResourceID   *uint     `json:"resourceId"` // 完成后生成的附件
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"index" json:"updatedAt"`
 }
 
 type UserSetting struct {
@@ -41,5 +282,7 @@ type UserSetting struct {
 	FontSize        int    `gorm:"default:14"`
 	BackgroundImage string `gorm:"size:255"`
 	Theme           string `gorm:"size:20;default:'light'"`
+	TimeZone        string `gorm:"size:64"` // IANA 时区名，如 Asia/Shanghai，为空时使用服务器时区
+	BackgroundSize  int64  // 背景图片文件大小，计入存储用量
 	User            User   `gorm:"foreignKey:UserID"`
 }
@@ -1,43 +1,141 @@
 package routes
 
 import (
+	"strings"
+	"time"
+
+	"backend/internal/config"
 	"backend/internal/controllers"
+	"backend/internal/mailer"
 	"backend/internal/middleware"
+	"backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(r *gin.Engine, db *gorm.DB, jwtSecret string) {
-	authController := controllers.NewAuthController(db, jwtSecret)
-	taskController := controllers.NewTaskController(db)
-	userController := controllers.NewUserController(db)
+func RegisterRoutes(r *gin.Engine, db *gorm.DB, cfg *config.Config, uploads *services.UploadService, resumable *services.ResumableUploads, sender mailer.Sender) {
+	sessions := services.NewSessionService(db, cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	tokens := services.NewPersonalTokenService(db)
+	accounts := services.NewAccountService(db, sender, sessions, cfg.AppBaseURL, cfg.PasswordResetTTL, cfg.EmailVerifyTTL)
+	twoFactor := services.NewTwoFactorService(db, cfg.TOTPIssuer, cfg.TwoFactorChallengeTTL)
+	guard := services.NewLoginGuard(db, cfg.LoginMaxFailures, cfg.LoginMaxFailuresPerIP, cfg.LoginFailureWindow, cfg.LoginLockout, cfg.LoginMaxLockout)
+	redirectURL := cfg.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(cfg.AppBaseURL, "/") + "/oidc/callback"
+	}
+	oidc := services.NewOIDCService(db, accounts, cfg.OIDCProviderName, cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, redirectURL, cfg.OIDCScopes)
+	// 重置密码邮件按邮箱和 IP 限制频率，超过后锁定一个窗口期
+	resetGuard := services.NewLoginGuard(db, cfg.PasswordResetMaxPerEmail, cfg.PasswordResetMaxPerIP, cfg.PasswordResetWindow, cfg.PasswordResetWindow, 24*time.Hour)
+	resetGuard.Prefix = "reset:"
+	resetGuard.AuditEvent = services.AuditPasswordResetLocked
+	authController := controllers.NewAuthController(db, sessions, accounts, twoFactor, guard, resetGuard, oidc, uploads)
+	taskController := controllers.NewTaskController(db, cfg.TrashRetention(), uploads)
+	userController := controllers.NewUserController(db, uploads)
+	tagController := controllers.NewTagController(db)
+	categoryController := controllers.NewCategoryController(db)
+	subtaskController := controllers.NewSubtaskController(db)
+	fileController := controllers.NewFileController(uploads)
+	dependencyController := controllers.NewDependencyController(db)
+	settingController := controllers.NewSettingController(db, uploads)
+	uploadController := controllers.NewUploadController(db, resumable)
+	twoFactorController := controllers.NewTwoFactorController(db, twoFactor)
+	tokenController := controllers.NewPersonalTokenController(tokens)
 
 	// 公共路由
 	r.POST("/api/auth/login", authController.Login)
+	r.POST("/api/auth/2fa/verify", authController.VerifyTwoFactor)
+	r.GET("/api/auth/oidc", authController.OIDCConfig)
+	r.GET("/api/auth/oidc/authorize", authController.OIDCAuthorize)
+	r.POST("/api/auth/oidc/callback", authController.OIDCCallback)
 	r.POST("/api/auth/register", authController.Register)
+	r.POST("/api/auth/refresh", authController.Refresh)
+	r.POST("/api/auth/forgot-password", authController.ForgotPassword)
+	r.POST("/api/auth/reset-password", authController.ResetPassword)
+	r.POST("/api/auth/verify-email", authController.VerifyEmail)
+	r.GET("/api/files/*key", fileController.GetFile)
 
-	// 需要鉴权的路由
+	// 需要鉴权的路由，账号相关的接口只接受登录会话
 	auth := r.Group("/api")
-	auth.Use(middleware.JWTAuth(jwtSecret))
+	auth.Use(middleware.JWTAuth(sessions, tokens))
 	{
-		auth.GET("/user/profile", userController.Profile)
-		auth.GET("/tasks", taskController.GetTasks)
-		auth.POST("/tasks", taskController.CreateTask)
-		auth.PUT("/tasks/:id", taskController.UpdateTask)
-		auth.DELETE("/tasks/:id", taskController.DeleteTask)
-		auth.DELETE("/tasks/permanent/:id", taskController.RemoveTaskPermanently)
+		auth.POST("/auth/logout", authController.Logout)
+		auth.GET("/auth/sessions", authController.GetSessions)
+		auth.DELETE("/auth/sessions", authController.RevokeOtherSessions)
+		auth.DELETE("/auth/sessions/:sessionId", authController.RevokeSession)
+		auth.PUT("/user/profile", authController.UpdateUserProfile)
+		auth.POST("/user/avatar", authController.UploadAvatar)
+		auth.POST("/user/email/verification", authController.ResendEmailVerification)
+		auth.GET("/user/2fa", twoFactorController.GetStatus)
+		auth.POST("/user/2fa/setup", twoFactorController.Setup)
+		auth.POST("/user/2fa/enable", twoFactorController.Enable)
+		auth.POST("/user/2fa/disable", twoFactorController.Disable)
+		auth.POST("/user/settings/background", settingController.UploadBackgroundImage)
+		auth.GET("/user/settings", settingController.GetUserSettings)
+		auth.PUT("/user/settings", settingController.UpdateUserSettings)
+		auth.GET("/user/tokens", tokenController.GetTokens)
+		auth.POST("/user/tokens", tokenController.CreateToken)
+		auth.DELETE("/user/tokens/:tokenId", tokenController.RevokeToken)
 	}
-}
 
-func RegisterTaskRoutes(r *gin.Engine, db *gorm.DB) {
-	tc := &controllers.TaskController{DB: db}
-	task := r.Group("/api/tasks")
+	// 以下路由同时接受拥有相应权限的个人访问令牌
+	profile := r.Group("/api")
+	profile.Use(middleware.JWTAuth(sessions, tokens, services.ScopeUserRead))
 	{
-		task.GET("", tc.ListTasks)
-		task.POST("", tc.CreateTask)
-		task.PUT("/:id", tc.UpdateTask)
-		task.DELETE("/:id", tc.DeleteTask)                      // 软删除
-		task.DELETE("/permanent/:id", tc.RemoveTaskPermanently) // 彻底删除
+		profile.GET("/user/profile", userController.Profile)
+		profile.GET("/user/storage", userController.StorageUsage)
+	}
+
+	tasksRead := r.Group("/api")
+	tasksRead.Use(middleware.JWTAuth(sessions, tokens, services.ScopeTasksRead))
+	{
+		tasksRead.GET("/tasks", taskController.GetTasks)
+		tasksRead.GET("/tasks/trash", taskController.GetTrash)
+		tasksRead.GET("/tasks/:id/subtasks", subtaskController.GetSubtasks)
+		tasksRead.GET("/tasks/:id/resources", taskController.GetTaskResources)
+		tasksRead.GET("/tasks/:id/resources/:resourceId/download", taskController.DownloadTaskResource)
+		tasksRead.GET("/tasks/:id/dependencies", dependencyController.GetDependencies)
+
+		tasksRead.GET("/tags", tagController.GetTags)
+
+		tasksRead.GET("/categories", categoryController.GetCategories)
+	}
+
+	tasksWrite := r.Group("/api")
+	tasksWrite.Use(middleware.JWTAuth(sessions, tokens, services.ScopeTasksWrite))
+	{
+		tasksWrite.POST("/tasks", taskController.CreateTask)
+		tasksWrite.PUT("/tasks/:id", taskController.UpdateTask)
+		tasksWrite.DELETE("/tasks/:id", taskController.DeleteTask)
+		tasksWrite.DELETE("/tasks/permanent/:id", taskController.RemoveTaskPermanently)
+		tasksWrite.DELETE("/tasks/trash", taskController.EmptyTrash)
+		tasksWrite.PUT("/tasks/restore", taskController.RestoreTasks)
+		tasksWrite.PUT("/tasks/:id/restore", taskController.RestoreTask)
+		tasksWrite.PUT("/tasks/:id/status", taskController.UpdateTaskStatus)
+		tasksWrite.POST("/tasks/:id/skip", taskController.SkipOccurrence)
+		tasksWrite.POST("/tasks/:id/subtasks", subtaskController.CreateSubtask)
+		tasksWrite.PUT("/tasks/:id/subtasks/reorder", subtaskController.ReorderSubtasks)
+		tasksWrite.PUT("/tasks/:id/subtasks/:subtaskId", subtaskController.UpdateSubtask)
+		tasksWrite.DELETE("/tasks/:id/subtasks/:subtaskId", subtaskController.DeleteSubtask)
+		tasksWrite.POST("/tasks/:id/resources", taskController.UploadTaskResource)
+		tasksWrite.PUT("/tasks/:id/resources/:resourceId", taskController.RenameTaskResource)
+		tasksWrite.DELETE("/tasks/:id/resources/:resourceId", taskController.DeleteTaskResource)
+		tasksWrite.POST("/tasks/:id/uploads", uploadController.CreateUpload)
+		tasksWrite.HEAD("/tasks/:id/uploads/:uploadId", uploadController.GetUploadOffset)
+		tasksWrite.PATCH("/tasks/:id/uploads/:uploadId", uploadController.PatchUpload)
+		tasksWrite.POST("/tasks/:id/uploads/:uploadId/finish", uploadController.FinishUpload)
+		tasksWrite.DELETE("/tasks/:id/uploads/:uploadId", uploadController.AbortUpload)
+		tasksWrite.POST("/tasks/:id/dependencies", dependencyController.AddDependency)
+		tasksWrite.DELETE("/tasks/:id/dependencies/:blockerId", dependencyController.RemoveDependency)
+
+		tasksWrite.POST("/tags", tagController.CreateTag)
+		tasksWrite.PUT("/tags/:id", tagController.UpdateTag)
+		tasksWrite.POST("/tags/:id/merge", tagController.MergeTag)
+		tasksWrite.DELETE("/tags/:id", tagController.DeleteTag)
+
+		tasksWrite.POST("/categories", categoryController.CreateCategory)
+		tasksWrite.PUT("/categories/reorder", categoryController.ReorderCategories)
+		tasksWrite.PUT("/categories/:id", categoryController.UpdateCategory)
+		tasksWrite.DELETE("/categories/:id", categoryController.DeleteCategory)
 	}
 }
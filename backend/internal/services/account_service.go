@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/internal/mailer"
+	"backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidResetToken  = errors.New("重置链接无效或已过期")
+	ErrInvalidVerifyToken = errors.New("验证链接无效或已过期")
+	ErrInvalidEmail       = errors.New("邮箱格式不正确")
+	ErrEmailTaken         = errors.New("该邮箱已被其他账号使用")
+)
+
+// 邮箱验证令牌的用途，防止其他 JWT 被当作验证链接使用
+const verifyEmailPurpose = "verify_email"
+
+// 每个用户同时有效的重置链接数上限，达到后不再发送新邮件
+const maxPendingResets = 3
+
+// AccountService 找回密码、邮箱验证等需要通过邮件完成的账号操作
+type AccountService struct {
+	DB        *gorm.DB
+	Mailer    mailer.Sender
+	Sessions  *SessionService
+	BaseURL   string // 前端地址，邮件中的链接指向前端页面
+	ResetTTL  time.Duration
+	VerifyTTL time.Duration
+}
+
+func NewAccountService(db *gorm.DB, sender mailer.Sender, sessions *SessionService, baseURL string, resetTTL, verifyTTL time.Duration) *AccountService {
+	return &AccountService{
+		DB:        db,
+		Mailer:    sender,
+		Sessions:  sessions,
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		ResetTTL:  resetTTL,
+		VerifyTTL: verifyTTL,
+	}
+}
+
+// NormalizeEmail 校验邮箱格式，返回去掉空白后的地址
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// EmailTaken 邮箱是否已被其他用户验证
+func (a *AccountService) EmailTaken(email string, exceptUserID uint) (bool, error) {
+	return emailTaken(a.DB, email, exceptUserID)
+}
+
+// lockUser 在事务 tx 中锁定用户行（无实际修改的更新），同一用户的操作在事务结束前依次进行
+func lockUser(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("storage_quota_mb", gorm.Expr("storage_quota_mb")).Error
+}
+
+func emailTaken(tx *gorm.DB, email string, exceptUserID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.User{}).
+		Where("email = ? AND email_verified = ? AND id <> ?", email, true, exceptUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ChangeEmail 把新邮箱记为待验证，验证通过前 Email 保持不变；只修改 user，不保存
+func (a *AccountService) ChangeEmail(user *models.User, email string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	if email == user.Email {
+		user.PendingEmail = ""
+		return nil
+	}
+	taken, err := a.EmailTaken(email, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+	if user.Email == "" {
+		// 还没有邮箱时直接使用，同样需要验证
+		user.Email = email
+		user.EmailVerified = false
+		return nil
+	}
+	user.PendingEmail = email
+	return nil
+}
+
+// SendEmailVerification 给待验证的邮箱（修改中的新邮箱或尚未验证的邮箱）发送验证链接，没有时什么也不做
+func (a *AccountService) SendEmailVerification(ctx context.Context, user *models.User) error {
+	email := user.PendingEmail
+	if email == "" && !user.EmailVerified {
+		email = user.Email
+	}
+	if email == "" {
+		return nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": verifyEmailPurpose,
+		"userID":  user.ID,
+		"email":   email,
+		"exp":     time.Now().Add(a.VerifyTTL).Unix(),
+	})
+	signed, err := token.SignedString([]byte(a.Sessions.Secret))
+	if err != nil {
+		return err
+	}
+	link := a.BaseURL + "/verify-email?token=" + url.QueryEscape(signed)
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      []string{email},
+		Subject: "验证邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %d 小时内打开下面的链接，确认 %s 是账号 %s 的邮箱：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件。\n",
+			user.Nickname, int(a.VerifyTTL/time.Hour), email, user.Username, link),
+	})
+}
+
+// VerifyEmail 校验邮件中的签名链接，通过后邮箱生效并标记为已验证
+func (a *AccountService) VerifyEmail(tokenString string) (*models.User, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidVerifyToken
+		}
+		return []byte(a.Sessions.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidVerifyToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != verifyEmailPurpose {
+		return nil, ErrInvalidVerifyToken
+	}
+	userID, _ := claims["userID"].(float64)
+	email, _ := claims["email"].(string)
+
+	var user models.User
+	if err := a.DB.First(&user, uint(userID)).Error; err != nil {
+		return nil, ErrInvalidVerifyToken
+	}
+	switch {
+	case email == user.PendingEmail:
+		user.Email = email
+		user.PendingEmail = ""
+	case email == user.Email && !user.EmailVerified:
+	case email == user.Email:
+		return &user, nil // 重复打开链接
+	default:
+		// 之后又改过邮箱，旧链接作废
+		return nil, ErrInvalidVerifyToken
+	}
+
+	taken, err := a.EmailTaken(email, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+	user.EmailVerified = true
+	if err := a.DB.Model(&user).Select("email", "pending_email", "email_verified").Updates(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset 给使用该邮箱的账号发送重置密码链接；邮箱不存在时什么也不做，
+// 调用方不应向客户端区分这两种情况
+func (a *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+	var users []models.User
+	// 只发给已验证的邮箱
+	if err := a.DB.Where("email = ? AND email_verified = ?", email, true).Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		var pending int64
+		if err := a.DB.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending >= maxPendingResets {
+			continue
+		}
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		reset := models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(a.ResetTTL),
+		}
+		if err := a.DB.Create(&reset).Error; err != nil {
+			return err
+		}
+
+		link := a.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+		err = a.Mailer.Send(ctx, mailer.Message{
+			To:      []string{user.Email},
+			Subject: "重置密码",
+			Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置账号 %s 密码的请求，请在 %d 分钟内打开下面的链接设置新密码：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件，你的密码不会改变。\n",
+				user.Nickname, user.Username, int(a.ResetTTL/time.Minute), link),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetPassword 用邮件中的令牌设置新密码，令牌只能使用一次；成功后注销该用户的所有会话
+func (a *AccountService) ResetPassword(token, newPassword string) error {
+	var reset models.PasswordReset
+	if err := a.DB.Where("token_hash = ?", hashToken(token)).First(&reset).Error; err != nil {
+		return ErrInvalidResetToken
+	}
+	now := time.Now()
+	if reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&reset).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", reset.UserID).
+			Update("password", string(hashed)).Error; err != nil {
+			return err
+		}
+		// 同一用户其他未使用的重置链接一并作废
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		// 与改密码放在同一事务中，避免密码已改而旧会话和访问令牌仍然有效
+		if err := revokeUserSessions(tx, reset.UserID); err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, reset.UserID)
+	})
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// errBlobReleased 写入存储时内容已保存过，登记引用前最后一个引用却被释放
+var errBlobReleased = errors.New("附件内容已被释放")
+
+// PendingBlob 已校验并计算过哈希、尚未登记引用的附件内容
+type PendingBlob struct {
+	StoredFile // Key 在 AcquireBlob 之后才有值
+
+	open     func() (io.ReadCloser, error)
+	uploaded string // 本次写入存储的文件，事务回滚或未被采用时由 CommitBlobs 删除
+}
+
+// PrepareAttachment 校验附件的大小和类型并计算 SHA-256，不写入存储
+func (s *UploadService) PrepareAttachment(file *multipart.FileHeader) (*PendingBlob, error) {
+	limit := s.Limits[UploadAttachment]
+	if limit > 0 && file.Size > limit {
+		return nil, ErrFileTooLarge
+	}
+	return prepareBlob(file.Filename, limit, func() (io.ReadCloser, error) {
+		return file.Open()
+	})
+}
+
+func prepareBlob(filename string, limit int64, open func() (io.ReadCloser, error)) (*PendingBlob, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType := detectContentType(head[:n], filename)
+	if !isAllowedType(UploadAttachment, contentType) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	hash := sha256.New()
+	hash.Write(head[:n])
+	rest, err := io.Copy(hash, r)
+	if err != nil {
+		return nil, err
+	}
+	// 客户端声明的大小不可信，以实际读取的为准
+	size := int64(n) + rest
+	if limit > 0 && size > limit {
+		return nil, ErrFileTooLarge
+	}
+	return &PendingBlob{
+		StoredFile: StoredFile{Size: size, ContentType: contentType, SHA256: hex.EncodeToString(hash.Sum(nil))},
+		open:       open,
+	}, nil
+}
+
+// CommitBlobs 先在事务之外把尚未保存过的内容写入存储（保存到 attachments/sha256/ 下），
+// 再调用 commit，由它在事务中对每个 blob 调用 AcquireBlob 并保存附件记录；
+// 事务中不访问存储，大文件上传期间不占用数据库连接和锁。
+// 写入存储后、登记引用前内容被释放时重新上传一次；结束后删除未被采用的文件
+func (s *UploadService) CommitBlobs(ctx context.Context, db *gorm.DB, blobs []*PendingBlob, commit func() error) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = s.uploadBlobs(ctx, db, blobs, attempt > 0); err != nil {
+			break
+		}
+		if err = commit(); !errors.Is(err, errBlobReleased) {
+			break
+		}
+	}
+	s.finishBlobs(ctx, err == nil, blobs)
+	return err
+}
+
+// uploadBlobs 写入存储中还没有的内容，force 时不检查是否已保存过。
+// 每份新内容使用新的文件名，释放后删除旧文件不会影响之后重新上传的相同内容
+func (s *UploadService) uploadBlobs(ctx context.Context, db *gorm.DB, blobs []*PendingBlob, force bool) error {
+	for _, b := range blobs {
+		if b.uploaded != "" {
+			continue
+		}
+		if !force {
+			var count int64
+			if err := db.Model(&models.Blob{}).Where("sha256 = ?", b.SHA256).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+		}
+
+		suffix, err := randomName()
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/sha256/%s/%s-%s", UploadAttachment, b.SHA256[:2], b.SHA256, suffix[:8])
+		r, err := b.open()
+		if err != nil {
+			return err
+		}
+		err = s.Store.Put(ctx, key, r, b.Size, b.ContentType)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		b.uploaded = key
+	}
+	return nil
+}
+
+// AcquireBlob 在事务 tx 中登记对内容的一次引用，须与附件记录在同一事务中提交，只能在 CommitBlobs 的 commit 中调用。
+// 已有相同内容时只增加引用计数，否则记录 CommitBlobs 写入的文件
+func AcquireBlob(tx *gorm.DB, b *PendingBlob) error {
+	if ok, err := addBlobRef(tx, b); err != nil || ok {
+		return err
+	}
+	if b.uploaded == "" {
+		return errBlobReleased
+	}
+
+	// 并发保存相同内容时插入会因主键冲突失败，此时改为引用先提交的一份
+	blob := models.Blob{SHA256: b.SHA256, Key: b.uploaded, Size: b.Size, ContentType: b.ContentType, RefCount: 1}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&blob).Error
+	})
+	if err == nil {
+		b.Key = blob.Key
+		return nil
+	}
+	if ok, retryErr := addBlobRef(tx, b); retryErr != nil || ok {
+		return retryErr
+	}
+	return err
+}
+
+// addBlobRef 内容已保存时增加引用计数并返回 true；更新会锁定该行，直到事务结束
+func addBlobRef(tx *gorm.DB, b *PendingBlob) (bool, error) {
+	result := tx.Model(&models.Blob{}).Where("sha256 = ?", b.SHA256).
+		Update("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	var blob models.Blob
+	if err := tx.Where("sha256 = ?", b.SHA256).First(&blob).Error; err != nil {
+		return false, err
+	}
+	b.Key = blob.Key
+	return true, nil
+}
+
+// finishBlobs 删除本次写入存储但没有被采用的文件
+func (s *UploadService) finishBlobs(ctx context.Context, committed bool, blobs []*PendingBlob) {
+	for _, b := range blobs {
+		if b.uploaded == "" || (committed && b.uploaded == b.Key) {
+			continue
+		}
+		if err := s.Store.Delete(ctx, b.uploaded); err != nil {
+			log.Printf("删除未使用的附件文件 %s 失败: %v", b.uploaded, err)
+		}
+		b.uploaded = ""
+	}
+}
+
+// releaseBlob 在事务 tx 中减少内容的引用计数，最后一个引用被删除时删除记录并返回存储中的文件
+func releaseBlob(tx *gorm.DB, sha string) (string, error) {
+	// 先更新再读取，更新会锁定该行，并发的登记和释放依次进行
+	result := tx.Model(&models.Blob{}).Where("sha256 = ?", sha).
+		Update("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return "", result.Error
+	}
+	var blob models.Blob
+	if err := tx.Where("sha256 = ?", sha).First(&blob).Error; err != nil {
+		return "", err
+	}
+	if blob.RefCount > 0 {
+		return "", nil
+	}
+	if err := tx.Delete(&blob).Error; err != nil {
+		return "", err
+	}
+	return blob.Key, nil
+}
+
+// ReleaseResources 在删除附件记录的事务 tx 中释放附件引用的内容，
+// 返回事务提交后需要从存储中删除的文件，交给 RemoveFiles 处理
+func ReleaseResources(tx *gorm.DB, resources []models.TaskResource) ([]string, error) {
+	var keys []string
+	for _, r := range resources {
+		if r.BlobSHA256 == "" {
+			keys = append(keys, r.FilePath)
+			continue
+		}
+		key, err := releaseBlob(tx, r.BlobSHA256)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RemoveFiles 删除存储中的文件，失败只记录日志
+func (s *UploadService) RemoveFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.Remove(ctx, key); err != nil {
+			log.Printf("删除附件文件 %s 失败: %v", key, err)
+		}
+	}
+}
+
+var errBlobMigrated = errors.New("附件已迁移或已删除")
+
+// AutoMigrate 为已有的表添加 blob_sha256 列时，旧记录的值为 NULL 而不是空字符串
+const legacyBlobCondition = "(blob_sha256 IS NULL OR blob_sha256 = '')"
+
+// BackfillBlobs 将按旧方式单独保存的附件（BlobSHA256 为空）迁移到按内容去重的存储中，
+// 文件缺失或读取失败的附件记录日志后跳过，下次启动时重试
+func (s *UploadService) BackfillBlobs(ctx context.Context, db *gorm.DB) {
+	var lastID uint
+	migrated := 0
+	for {
+		var resources []models.TaskResource
+		if err := db.Unscoped().Where("id > ? AND "+legacyBlobCondition, lastID).
+			Order("id").Limit(100).Find(&resources).Error; err != nil {
+			log.Printf("迁移旧附件失败: %v", err)
+			return
+		}
+		if len(resources) == 0 {
+			break
+		}
+		for i := range resources {
+			lastID = resources[i].ID
+			err := s.backfillBlob(ctx, db, &resources[i])
+			if errors.Is(err, errBlobMigrated) {
+				continue
+			}
+			if err != nil {
+				log.Printf("迁移附件 %d（%s）失败: %v", resources[i].ID, resources[i].FilePath, err)
+				continue
+			}
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		log.Printf("已将 %d 个旧附件迁移到去重存储", migrated)
+	}
+}
+
+// backfillBlob 按上传新附件的方式保存一份内容，再删除原来的文件
+func (s *UploadService) backfillBlob(ctx context.Context, db *gorm.DB, resource *models.TaskResource) error {
+	open := func() (io.ReadCloser, error) {
+		obj, err := s.Store.Get(ctx, resource.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		return obj.Body, nil
+	}
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	blob := &PendingBlob{
+		StoredFile: StoredFile{Size: size, ContentType: resource.ContentType, SHA256: hex.EncodeToString(hash.Sum(nil))},
+		open:       open,
+	}
+
+	err = s.CommitBlobs(ctx, db, []*PendingBlob{blob}, func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.TaskResource{}).Unscoped().
+				Where("id = ? AND "+legacyBlobCondition, resource.ID).
+				Update("blob_sha256", blob.SHA256)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errBlobMigrated
+			}
+			if err := AcquireBlob(tx, blob); err != nil {
+				return err
+			}
+			return tx.Model(&models.TaskResource{}).Unscoped().
+				Where("id = ?", resource.ID).Update("file_path", blob.Key).Error
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return s.Remove(ctx, resource.FilePath)
+}
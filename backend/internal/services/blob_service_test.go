@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+func newTestUploads(t *testing.T) (*UploadService, *gorm.DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db := newTestDB(t, &models.Blob{}, &models.TaskResource{})
+	return NewUploadService(storage.NewLocal(dir), nil, 0), db, dir
+}
+
+func pendingBlob(t *testing.T, content string) *PendingBlob {
+	t.Helper()
+	b, err := prepareBlob("a.txt", 0, func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// commitBlob 保存内容并在事务中登记一次引用、创建附件记录，before 在事务开始前调用
+func commitBlob(s *UploadService, db *gorm.DB, b *PendingBlob, before func()) error {
+	return s.CommitBlobs(context.Background(), db, []*PendingBlob{b}, func() error {
+		if before != nil {
+			before()
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := AcquireBlob(tx, b); err != nil {
+				return err
+			}
+			return tx.Create(&models.TaskResource{TaskID: 1, FileName: "a.txt", FilePath: b.Key, BlobSHA256: b.SHA256}).Error
+		})
+	})
+}
+
+func acquire(t *testing.T, s *UploadService, db *gorm.DB, content string) *PendingBlob {
+	t.Helper()
+	b := pendingBlob(t, content)
+	if err := commitBlob(s, db, b, nil); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files
+}
+
+func refCount(t *testing.T, db *gorm.DB, sha string) int {
+	t.Helper()
+	var blob models.Blob
+	if err := db.Where("sha256 = ?", sha).First(&blob).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0
+		}
+		t.Fatal(err)
+	}
+	return blob.RefCount
+}
+
+func TestBlobAcquireAndRelease(t *testing.T) {
+	s, db, dir := newTestUploads(t)
+	ctx := context.Background()
+
+	a := acquire(t, s, db, "hello")
+	b := acquire(t, s, db, "hello")
+	if a.Key != b.Key || refCount(t, db, a.SHA256) != 2 {
+		t.Fatalf("相同内容应共用一份文件: %q %q, ref_count = %d", a.Key, b.Key, refCount(t, db, a.SHA256))
+	}
+	if files := storedFiles(t, dir); len(files) != 1 || files[0] != a.Key {
+		t.Fatalf("存储中的文件 = %v", files)
+	}
+
+	// 事务回滚时引用计数不变，新写入的文件被删除
+	c := pendingBlob(t, "world")
+	err := s.CommitBlobs(ctx, db, []*PendingBlob{c}, func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := AcquireBlob(tx, c); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+	})
+	if err == nil || refCount(t, db, c.SHA256) != 0 || len(storedFiles(t, dir)) != 1 {
+		t.Fatalf("回滚后不应留下记录或文件: %v", storedFiles(t, dir))
+	}
+
+	var resources []models.TaskResource
+	db.Order("id").Find(&resources)
+	for i, want := range []int{1, 0} {
+		var removed []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&resources[i]).Error; err != nil {
+				return err
+			}
+			var err error
+			removed, err = ReleaseResources(tx, resources[i:i+1])
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.RemoveFiles(ctx, removed)
+		if got := refCount(t, db, a.SHA256); got != want {
+			t.Fatalf("ref_count = %d, want %d", got, want)
+		}
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Fatalf("最后一个引用释放后应删除文件: %v", files)
+	}
+
+	// 释放后重新上传相同内容使用新的文件名，不会被释放时删除的旧文件影响
+	d := acquire(t, s, db, "hello")
+	if d.Key == a.Key {
+		t.Errorf("重新保存的内容应使用新的文件名: %q", d.Key)
+	}
+}
+
+// 另一个事务在本次查询之后、插入之前保存了相同内容
+func TestBlobAcquireInsertRace(t *testing.T) {
+	s, db, dir := newTestUploads(t)
+
+	winner := pendingBlob(t, "same")
+	raced := false
+	db.Callback().Update().After("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "blobs" || tx.RowsAffected != 0 {
+			return
+		}
+		raced = true
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(&models.Blob{
+			SHA256: winner.SHA256, Key: "attachments/sha256/winner", Size: 4, RefCount: 1,
+		}).Error; err != nil {
+			t.Error(err)
+		}
+	})
+
+	b := acquire(t, s, db, "same")
+	if !raced {
+		t.Fatal("没有触发并发插入")
+	}
+	if b.Key != "attachments/sha256/winner" || refCount(t, db, b.SHA256) != 2 {
+		t.Fatalf("应引用先保存的一份: key = %q, ref_count = %d", b.Key, refCount(t, db, b.SHA256))
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("未被采用的文件应删除: %v", files)
+	}
+}
+
+// 写入存储时内容已存在，事务开始前最后一个引用被释放，应重新上传后登记
+func TestBlobReleasedBeforeCommit(t *testing.T) {
+	s, db, dir := newTestUploads(t)
+	ctx := context.Background()
+
+	a := acquire(t, s, db, "hello")
+	b := pendingBlob(t, "hello")
+	attempts := 0
+	err := commitBlob(s, db, b, func() {
+		attempts++
+		if attempts > 1 {
+			return
+		}
+		var resource models.TaskResource
+		db.First(&resource)
+		var removed []string
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&resource).Error; err != nil {
+				return err
+			}
+			var err error
+			removed, err = ReleaseResources(tx, []models.TaskResource{resource})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		s.RemoveFiles(ctx, removed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || b.Key == a.Key || refCount(t, db, b.SHA256) != 1 {
+		t.Fatalf("attempts = %d, key = %q, ref_count = %d", attempts, b.Key, refCount(t, db, b.SHA256))
+	}
+	if files := storedFiles(t, dir); len(files) != 1 || files[0] != b.Key {
+		t.Errorf("存储中的文件 = %v", files)
+	}
+}
+
+func TestBackfillBlobs(t *testing.T) {
+	s, db, dir := newTestUploads(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"attachments/1/a.txt", "attachments/1/b.txt"} {
+		if err := s.Store.Put(ctx, key, strings.NewReader("legacy"), 6, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	existing := acquire(t, s, db, "legacy")
+	legacy := []models.TaskResource{
+		{TaskID: 1, FileName: "a.txt", FilePath: "attachments/1/a.txt", FileSize: 6, ContentType: "text/plain"},
+		{TaskID: 1, FileName: "b.txt", FilePath: "attachments/1/b.txt", FileSize: 6, ContentType: "text/plain"},
+		{TaskID: 1, FileName: "c.txt", FilePath: "attachments/1/missing.txt", FileSize: 6, ContentType: "text/plain"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.BackfillBlobs(ctx, db)
+
+	var resources []models.TaskResource
+	db.Order("id").Find(&resources)
+	for _, r := range resources[:3] {
+		if r.BlobSHA256 != existing.SHA256 || r.FilePath != existing.Key {
+			t.Errorf("附件 %d 应迁移到已有内容: %+v", r.ID, r)
+		}
+	}
+	if r := resources[3]; r.BlobSHA256 != "" || r.FilePath != "attachments/1/missing.txt" {
+		t.Errorf("文件缺失的附件应保持不变: %+v", r)
+	}
+	if got := refCount(t, db, existing.SHA256); got != 3 {
+		t.Errorf("ref_count = %d, want 3", got)
+	}
+	if files := storedFiles(t, dir); len(files) != 1 || files[0] != existing.Key {
+		t.Errorf("迁移后应只保留一份文件: %v", files)
+	}
+}
+
+// 升级前的 task_resources 表没有 blob_sha256 列，AutoMigrate 添加后旧记录的值为 NULL
+func TestBackfillBlobsAfterMigrate(t *testing.T) {
+	s, db, dir := newTestUploads(t)
+	ctx := context.Background()
+
+	if err := db.Migrator().DropTable(&models.TaskResource{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`CREATE TABLE task_resources (
+		id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime, deleted_at datetime,
+		task_id integer NOT NULL, file_name varchar(255) NOT NULL, file_path varchar(255) NOT NULL,
+		file_size integer, content_type varchar(100))`).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"attachments/1/a.txt", "attachments/1/b.txt"} {
+		if err := s.Store.Put(ctx, key, strings.NewReader("legacy"), 6, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("INSERT INTO task_resources (task_id, file_name, file_path, file_size, content_type) VALUES (?, ?, ?, ?, ?)",
+			1, fmt.Sprintf("%c.txt", 'a'+i), key, 6, "text/plain").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AutoMigrate(&models.TaskResource{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.BackfillBlobs(ctx, db)
+
+	var resources []models.TaskResource
+	db.Order("id").Find(&resources)
+	if len(resources) != 2 || resources[0].BlobSHA256 == "" || resources[0].FilePath != resources[1].FilePath {
+		t.Fatalf("旧附件应迁移到同一份内容: %+v", resources)
+	}
+	if got := refCount(t, db, resources[0].BlobSHA256); got != 2 {
+		t.Errorf("ref_count = %d, want 2", got)
+	}
+	if files := storedFiles(t, dir); len(files) != 1 || files[0] != resources[0].FilePath {
+		t.Errorf("迁移后应只保留一份文件: %v", files)
+	}
+}
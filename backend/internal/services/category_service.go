@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("分类不存在")
+	ErrCategoryArchived    = errors.New("分类已归档")
+	ErrInvalidCategoryName = errors.New("分类名不能超过 50 个字符")
+)
+
+// ResolveCategoryID 根据分类 ID 或名称查找用户未归档的分类，优先使用 ID；
+// 按名称查找时不存在的自动创建（与标签一致），排在最后。
+// id 为 0 表示不设置分类，两者都为空时返回 nil。
+func ResolveCategoryID(db *gorm.DB, userID uint, id *uint, name string) (*uint, error) {
+	name = strings.TrimSpace(name)
+	if id != nil {
+		if *id == 0 {
+			return nil, nil
+		}
+		var category models.Category
+		err := db.Where("id = ? AND user_id = ? AND archived = ?", *id, userID, false).First(&category).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &category.ID, nil
+	}
+	if name == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		return nil, ErrInvalidCategoryName
+	}
+
+	category, err := findCategoryByName(db, userID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var maxOrder struct{ Value *int }
+		db.Model(&models.Category{}).Select("MAX(sort_order) AS value").Where("user_id = ?", userID).Scan(&maxOrder)
+		category = &models.Category{UserID: userID, Name: name}
+		if maxOrder.Value != nil {
+			category.SortOrder = *maxOrder.Value + 1
+		}
+		if err = db.Create(category).Error; err != nil {
+			// 并发创建同名分类时唯一索引冲突，改用已创建的
+			category, err = findCategoryByName(db, userID, name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if category.Archived {
+		return nil, ErrCategoryArchived
+	}
+	return &category.ID, nil
+}
+
+func findCategoryByName(db *gorm.DB, userID uint, name string) (*models.Category, error) {
+	var category models.Category
+	if err := db.Where("user_id = ? AND name = ?", userID, name).First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// MigrateLegacyCategories 将旧版 tasks.category 中的分类名转换为 Category 记录并关联任务，迁移完成后删除该列
+func MigrateLegacyCategories(db *gorm.DB) error {
+	// Task.Category 现在是关联字段，这里必须用表名访问旧列
+	if !db.Migrator().HasColumn("tasks", "category") {
+		return nil
+	}
+
+	var rows []struct {
+		ID       uint
+		UserID   uint
+		Category string
+	}
+	if err := db.Table("tasks").Select("id, user_id, category").Where("category IS NOT NULL AND category <> ''").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	// 按用户和去掉空白、截断到字段长度后的名称分组
+	type key struct {
+		userID uint
+		name   string
+	}
+	groups := make(map[key][]uint)
+	var keys []key
+	for _, row := range rows {
+		k := key{row.UserID, truncateLegacyName(strings.TrimSpace(row.Category))}
+		if k.name == "" {
+			continue
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], row.ID)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID < keys[j].userID
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		order := make(map[uint]int)
+		for _, k := range keys {
+			category := models.Category{UserID: k.userID, Name: k.name, SortOrder: order[k.userID]}
+			if err := tx.Where("user_id = ? AND name = ?", k.userID, k.name).FirstOrCreate(&category).Error; err != nil {
+				return err
+			}
+			order[k.userID]++
+			if err := tx.Model(&models.Task{}).Where("id IN ?", groups[k]).Update("category_id", category.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn("tasks", "category")
+	})
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"container/heap"
+	"errors"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDependencySelf  = errors.New("任务不能依赖自身")
+	ErrDependencyCycle = errors.New("添加该依赖会形成循环")
+)
+
+// userDependencies 读取用户所有任务的依赖，返回 任务 -> 阻塞它的任务 列表
+func userDependencies(db *gorm.DB, userID uint) (map[uint][]uint, error) {
+	var deps []models.TaskDependency
+	if err := db.Where("task_id IN (SELECT id FROM tasks WHERE user_id = ?)", userID).Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	graph := make(map[uint][]uint)
+	for _, d := range deps {
+		graph[d.TaskID] = append(graph[d.TaskID], d.BlockerID)
+	}
+	return graph, nil
+}
+
+// AddDependency 添加 taskID 被 blockerID 阻塞的依赖，两个任务须属于同一用户，并检查循环；
+// tx 须为事务，检查和插入期间锁定用户行
+func AddDependency(tx *gorm.DB, userID, taskID, blockerID uint) error {
+	if taskID == blockerID {
+		return ErrDependencySelf
+	}
+	// 并发添加 A→B 和 B→A 时都可能通过检查，锁定用户行使检查和插入依次进行
+	if err := lockUser(tx, userID); err != nil {
+		return err
+	}
+	graph, err := userDependencies(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// 从 blocker 沿着"被谁阻塞"向上查找，能走到 task 说明会形成循环
+	visited := map[uint]bool{blockerID: true}
+	stack := []uint{blockerID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range graph[id] {
+			if next == taskID {
+				return ErrDependencyCycle
+			}
+			if !visited[next] {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	dep := models.TaskDependency{TaskID: taskID, BlockerID: blockerID}
+	return tx.Where(dep).FirstOrCreate(&dep).Error
+}
+
+// OpenBlockers 返回仍未结束（且不在回收站）的阻塞任务
+func OpenBlockers(db *gorm.DB, taskID uint) ([]models.Task, error) {
+	var blockers []models.Task
+	err := db.Where("id IN (SELECT blocker_id FROM task_dependencies WHERE task_id = ?)", taskID).
+		Where("is_deleted = ? AND status NOT IN ?", false, []string{models.TaskStatusDone, models.TaskStatusCancelled}).
+		Find(&blockers).Error
+	return blockers, err
+}
+
+// LoadBlockers 为任务列表填充 BlockedBy
+func LoadBlockers(db *gorm.DB, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+	var deps []models.TaskDependency
+	if err := db.Where("task_id IN ?", ids).Order("blocker_id").Find(&deps).Error; err != nil {
+		return err
+	}
+	byTask := make(map[uint][]uint)
+	for _, d := range deps {
+		byTask[d.TaskID] = append(byTask[d.TaskID], d.BlockerID)
+	}
+	for i := range tasks {
+		tasks[i].BlockedBy = byTask[tasks[i].ID]
+		if tasks[i].BlockedBy == nil {
+			tasks[i].BlockedBy = []uint{}
+		}
+	}
+	return nil
+}
+
+// SortByDependencies 按依赖关系排序（阻塞者在前），没有依赖关系的任务保持原有顺序。
+// 需要先调用 LoadBlockers。
+func SortByDependencies(tasks []models.Task) {
+	ids := make([]uint, len(tasks))
+	blockedBy := make(map[uint][]uint, len(tasks))
+	position := make(map[uint]int, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+		blockedBy[tasks[i].ID] = tasks[i].BlockedBy
+		position[tasks[i].ID] = i
+	}
+	sorted := make([]models.Task, len(tasks))
+	for k, id := range dependencyOrder(ids, blockedBy) {
+		sorted[k] = tasks[position[id]]
+	}
+	copy(tasks, sorted)
+}
+
+// DependencyPage 按依赖关系排序 query 选出的任务，返回第 offset 个起最多 limit 个任务的 ID。
+// 只读取任务 ID 和依赖关系，不为了分页加载全部任务；query 需已按原顺序排序
+func DependencyPage(db, query *gorm.DB, userID uint, offset, limit int) ([]uint, error) {
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	blockedBy, err := userDependencies(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	ordered := dependencyOrder(ids, blockedBy)
+	start := min(offset, len(ordered))
+	end := min(start+limit, len(ordered))
+	return ordered[start:end], nil
+}
+
+// dependencyOrder 拓扑排序，只考虑 ids 内部的依赖，每次取原顺序最靠前的可用任务
+func dependencyOrder(ids []uint, blockedBy map[uint][]uint) []uint {
+	index := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	indegree := make([]int, len(ids))
+	blocking := make([][]int, len(ids))
+	for i, id := range ids {
+		for _, b := range blockedBy[id] {
+			if j, ok := index[b]; ok {
+				indegree[i]++
+				blocking[j] = append(blocking[j], i)
+			}
+		}
+	}
+
+	ready := &minHeap{}
+	for i := range ids {
+		if indegree[i] == 0 {
+			*ready = append(*ready, i)
+		}
+	}
+	heap.Init(ready)
+	order := make([]uint, 0, len(ids))
+	placed := make([]bool, len(ids))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		order = append(order, ids[i])
+		placed[i] = true
+		for _, j := range blocking[i] {
+			indegree[j]--
+			if indegree[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	// 理论上不会有循环，保险起见把剩余任务按原顺序追加
+	for i, id := range ids {
+		if !placed[i] {
+			order = append(order, id)
+		}
+	}
+	return order
+}
+
+// minHeap 可用任务在原顺序中的下标，Pop 返回最小的一个
+type minHeap []int
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// removeDependencies 删除与任务相关的所有依赖
+func removeDependencies(tx *gorm.DB, ids []uint) error {
+	return tx.Where("task_id IN ? OR blocker_id IN ?", ids, ids).Delete(&models.TaskDependency{}).Error
+}
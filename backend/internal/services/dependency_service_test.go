@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		ids       []uint
+		blockedBy map[uint][]uint
+		want      []uint
+	}{
+		{"无依赖保持原顺序", []uint{5, 3, 9}, nil, []uint{5, 3, 9}},
+		{"阻塞任务排在前面", []uint{1, 2, 3, 4, 5}, map[uint][]uint{1: {3}, 2: {3}}, []uint{3, 1, 2, 4, 5}},
+		{"链式依赖", []uint{1, 2, 3}, map[uint][]uint{1: {2}, 2: {3}}, []uint{3, 2, 1}},
+		{"解除阻塞后按原顺序取最靠前的", []uint{1, 2, 3, 4}, map[uint][]uint{1: {4}, 2: {4}}, []uint{3, 4, 1, 2}},
+		{"不在列表中的依赖忽略", []uint{1, 2}, map[uint][]uint{1: {99}}, []uint{1, 2}},
+		{"循环的任务按原顺序追加", []uint{1, 2, 3}, map[uint][]uint{1: {2}, 2: {1}}, []uint{3, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dependencyOrder(tt.ids, tt.blockedBy); !slices.Equal(got, tt.want) {
+				t.Errorf("dependencyOrder = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDependency(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Category{}, &models.Tag{}, &models.Task{}, &models.TaskDependency{})
+	user := models.User{Username: "dep", Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tasks := []models.Task{{Title: "a", UserID: user.ID}, {Title: "b", UserID: user.ID}, {Title: "c", UserID: user.ID}}
+	if err := db.Create(&tasks).Error; err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := tasks[0].ID, tasks[1].ID, tasks[2].ID
+	add := func(taskID, blockerID uint) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return AddDependency(tx, user.ID, taskID, blockerID)
+		})
+	}
+
+	if err := add(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := add(b, c); err != nil {
+		t.Fatal(err)
+	}
+	// 重复添加不报错
+	if err := add(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := add(a, a); !errors.Is(err, ErrDependencySelf) {
+		t.Errorf("自身依赖: %v", err)
+	}
+	if err := add(c, a); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("间接循环: %v", err)
+	}
+	var count int64
+	db.Model(&models.TaskDependency{}).Count(&count)
+	if count != 2 {
+		t.Errorf("依赖数量 = %d, want 2", count)
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidDueDate 截止日期格式错误
+var ErrInvalidDueDate = errors.New("截止日期格式错误")
+
+// 不带时区的截止时间格式，按用户时区解析
+var localDueLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// UserLocation 返回用户设置的时区，未设置或无效时使用服务器本地时区
+func UserLocation(db *gorm.DB, userID uint) *time.Location {
+	var setting models.UserSetting
+	if err := db.Select("time_zone").Where("user_id = ?", userID).First(&setting).Error; err != nil || setting.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(setting.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// ParseDueDate 解析截止日期。只有日期（2006-01-02）时视为全天任务，存为用户时区当天零点；
+// 带时间但没有时区的按用户时区解析，RFC3339 格式直接使用其中的时区。
+func ParseDueDate(s string, loc *time.Location) (due time.Time, allDay bool, err error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range localDueLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, ErrInvalidDueDate
+}
+
+// StartOfDay 返回 t 在 loc 时区中当天的零点
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// StartOfWeek 返回 t 在 loc 时区中所在周（周一开始）的零点
+func StartOfWeek(t time.Time, loc *time.Location) time.Time {
+	day := StartOfDay(t, loc)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// DueEnd 返回任务实际到期的时刻，全天任务到当天结束为止
+func DueEnd(task *models.Task) time.Time {
+	if task.AllDay {
+		return task.DueDate.AddDate(0, 0, 1)
+	}
+	return *task.DueDate
+}
+
+// DueState 计算任务相对于用户时区当前时间的到期状态：overdue / today / week / later，无截止日期或已结束时为空
+func DueState(task *models.Task, now time.Time, loc *time.Location) string {
+	if task.DueDate == nil || task.Status == models.TaskStatusDone || task.Status == models.TaskStatusCancelled {
+		return ""
+	}
+	today := StartOfDay(now, loc)
+	switch due := *task.DueDate; {
+	case !DueEnd(task).After(now):
+		return "overdue"
+	case due.Before(today.AddDate(0, 0, 1)):
+		return "today"
+	case due.Before(StartOfWeek(now, loc).AddDate(0, 0, 7)):
+		return "week"
+	default:
+		return "later"
+	}
+}
+
+// MigrateLegacyDueDates 将旧版字符串类型的 tasks.due_date 转换为时间类型，需在 AutoMigrate 之前执行。
+// 没有时区的日期按任务所属用户设置的时区解析，无法解析的日期会被置空并记录日志。
+func MigrateLegacyDueDates(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable("tasks") {
+		return nil
+	}
+	columns, err := m.ColumnTypes("tasks")
+	if err != nil {
+		return err
+	}
+	legacy := false
+	for _, col := range columns {
+		if strings.EqualFold(col.Name(), "due_date") {
+			typ := strings.ToLower(col.DatabaseTypeName())
+			legacy = strings.Contains(typ, "char") || strings.Contains(typ, "text")
+		}
+	}
+	if !legacy {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.RenameColumn("tasks", "due_date", "legacy_due_date"); err != nil {
+			return err
+		}
+		if err := m.AddColumn(&models.Task{}, "DueDate"); err != nil {
+			return err
+		}
+		if !m.HasColumn(&models.Task{}, "AllDay") {
+			if err := m.AddColumn(&models.Task{}, "AllDay"); err != nil {
+				return err
+			}
+		}
+
+		var rows []struct {
+			ID            uint
+			UserID        uint
+			LegacyDueDate string
+		}
+		if err := tx.Table("tasks").Select("id, user_id, legacy_due_date").Where("legacy_due_date IS NOT NULL AND legacy_due_date <> ''").Scan(&rows).Error; err != nil {
+			return err
+		}
+		// 与请求处理一致，按任务所属用户设置的时区解析；此时 user_settings 可能还没有 time_zone 列
+		hasZones := m.HasTable(&models.UserSetting{}) && m.HasColumn(&models.UserSetting{}, "TimeZone")
+		locations := make(map[uint]*time.Location)
+		for _, row := range rows {
+			loc, ok := locations[row.UserID]
+			if !ok {
+				loc = time.Local
+				if hasZones {
+					loc = UserLocation(tx, row.UserID)
+				}
+				locations[row.UserID] = loc
+			}
+			// 旧数据可能带有数据库返回的时间部分，只保留可识别的格式
+			due, allDay, err := ParseDueDate(row.LegacyDueDate, loc)
+			if err != nil {
+				log.Printf("任务 %d 的截止日期 %q 无法解析，已置空", row.ID, row.LegacyDueDate)
+				continue
+			}
+			if err := tx.Table("tasks").Where("id = ?", row.ID).
+				Updates(map[string]interface{}{"due_date": due, "all_day": allDay}).Error; err != nil {
+				return err
+			}
+		}
+		return m.DropColumn("tasks", "legacy_due_date")
+	})
+}
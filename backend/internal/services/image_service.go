@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册 gif 解码
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册 webp 解码
+)
+
+// 头像生成的尺寸（正方形边长），最大的一张保存在 User.AvatarURL
+var AvatarSizes = []int{64, 128, 256}
+
+const (
+	// 背景图片的最大边长，超过时等比缩小
+	maxBackgroundSide = 1920
+	// 解码前检查像素数，防止超大图片耗尽内存
+	maxImagePixels = 40_000_000
+	jpegQuality    = 85
+)
+
+var ErrInvalidImage = errors.New("无法识别的图片")
+
+// SaveAvatar 将头像居中裁剪为正方形并生成各个尺寸，返回最大尺寸的 key 和所有文件的总大小。
+// 重新编码后原图中的 EXIF 等元数据不会保留。
+func (s *UploadService) SaveAvatar(ctx context.Context, userID uint, file *multipart.FileHeader) (string, int64, error) {
+	img, err := s.decodeImage(UploadAvatar, file)
+	if err != nil {
+		return "", 0, err
+	}
+	img = cropSquare(img)
+
+	name, err := randomName()
+	if err != nil {
+		return "", 0, err
+	}
+	var saved []string
+	var total int64
+	for _, size := range AvatarSizes {
+		data, ext, err := encodeImage(resize(img, size, size))
+		if err != nil {
+			s.removeAll(ctx, saved)
+			return "", 0, err
+		}
+		key := fmt.Sprintf("%s/%d/%s_%d%s", UploadAvatar, userID, name, size, ext)
+		if err := s.Store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentTypeOf(ext)); err != nil {
+			s.removeAll(ctx, saved)
+			return "", 0, err
+		}
+		saved = append(saved, key)
+		total += int64(len(data))
+	}
+	return saved[len(saved)-1], total, nil
+}
+
+// SaveBackground 将背景图片等比缩小到 maxBackgroundSide 以内并重新压缩，返回 key 和文件大小
+func (s *UploadService) SaveBackground(ctx context.Context, userID uint, file *multipart.FileHeader) (string, int64, error) {
+	img, err := s.decodeImage(UploadBackground, file)
+	if err != nil {
+		return "", 0, err
+	}
+	b := img.Bounds()
+	if w, h := b.Dx(), b.Dy(); w > maxBackgroundSide || h > maxBackgroundSide {
+		if w >= h {
+			img = resize(img, maxBackgroundSide, h*maxBackgroundSide/w)
+		} else {
+			img = resize(img, w*maxBackgroundSide/h, maxBackgroundSide)
+		}
+	}
+
+	data, ext, err := encodeImage(img)
+	if err != nil {
+		return "", 0, err
+	}
+	name, err := randomName()
+	if err != nil {
+		return "", 0, err
+	}
+	key := fmt.Sprintf("%s/%d/%s%s", UploadBackground, userID, name, ext)
+	if err := s.Store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentTypeOf(ext)); err != nil {
+		return "", 0, err
+	}
+	return key, int64(len(data)), nil
+}
+
+// RemoveAvatar 删除头像的所有尺寸
+func (s *UploadService) RemoveAvatar(ctx context.Context, key string) {
+	s.removeAll(ctx, avatarKeys(key))
+}
+
+// AvatarURLs 根据 User.AvatarURL 返回各尺寸的地址，键为尺寸
+func AvatarURLs(avatarURL string) map[string]string {
+	urls := make(map[string]string, len(AvatarSizes))
+	largest := fmt.Sprintf("_%d.", AvatarSizes[len(AvatarSizes)-1])
+	i := strings.LastIndex(avatarURL, largest)
+	for _, size := range AvatarSizes {
+		if i < 0 {
+			// 旧版上传的头像只有一张原图
+			urls[fmt.Sprint(size)] = avatarURL
+			continue
+		}
+		urls[fmt.Sprint(size)] = fmt.Sprintf("%s_%d.%s", avatarURL[:i], size, avatarURL[i+len(largest):])
+	}
+	return urls
+}
+
+// avatarKeys 由最大尺寸的 key 推出所有尺寸的 key
+func avatarKeys(key string) []string {
+	if key == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(AvatarSizes))
+	for _, url := range AvatarURLs(key) {
+		keys = append(keys, url)
+	}
+	return keys
+}
+
+func (s *UploadService) removeAll(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		s.Remove(ctx, key)
+	}
+}
+
+// decodeImage 校验大小、类型和像素数后解码，JPEG 按 EXIF 方向摆正
+func (s *UploadService) decodeImage(kind UploadKind, file *multipart.FileHeader) (image.Image, error) {
+	if limit := s.Limits[kind]; limit > 0 && file.Size > limit {
+		return nil, ErrFileTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if limit := s.Limits[kind]; limit > 0 && int64(len(data)) > limit {
+		return nil, ErrFileTooLarge
+	}
+	if !isAllowedType(kind, detectContentType(data, file.Filename)) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrFileTooLarge
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// cropSquare 居中裁剪为正方形
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x, y), draw.Src)
+	return dst
+}
+
+func resize(img image.Image, w, h int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// encodeImage 不透明的图片压缩为 JPEG，带透明度的保留为 PNG
+func encodeImage(img image.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if isOpaque(img) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contentTypeOf(ext string) string {
+	if ext == ".png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// jpegOrientation 读取 JPEG 中 EXIF 的 Orientation（1-8），没有时返回 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation 在 TIFF 结构的第一个 IFD 中查找 0x0112 标签
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			v := int(order.Uint16(tiff[entry+8:]))
+			if v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation 按 EXIF 方向旋转 / 翻转图片，使去掉元数据后显示方向不变
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
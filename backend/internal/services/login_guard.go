@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 审计事件
+const (
+	AuditLoginLocked         = "login_locked"
+	AuditPasswordResetLocked = "password_reset_locked"
+)
+
+// LoginGuard 限制密码猜测：分别按用户名和 IP 统计窗口期内的登录失败次数，
+// 达到上限后临时锁定，锁定到期后再失败则锁定时长翻倍。
+// 设置 Prefix 和 AuditEvent 后也可以用于限制其他操作的频率，如发送重置密码邮件
+type LoginGuard struct {
+	DB            *gorm.DB
+	MaxFailures   int // 同一用户名，0 表示不限制
+	MaxIPFailures int // 同一 IP，0 表示不限制
+	Window        time.Duration
+	Lockout       time.Duration // 第一次锁定的时长
+	MaxLockout    time.Duration
+	Prefix        string // 计数键的前缀，区分不同用途
+	AuditEvent    string // 锁定时写入的审计事件
+}
+
+func NewLoginGuard(db *gorm.DB, maxFailures, maxIPFailures int, window, lockout, maxLockout time.Duration) *LoginGuard {
+	return &LoginGuard{
+		DB:            db,
+		MaxFailures:   maxFailures,
+		MaxIPFailures: maxIPFailures,
+		Window:        window,
+		Lockout:       lockout,
+		MaxLockout:    maxLockout,
+		AuditEvent:    AuditLoginLocked,
+	}
+}
+
+// Check 返回用户名或 IP 剩余的锁定时长，未锁定时为 0
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	now := time.Now()
+	if err := g.DB.Where("throttle_key IN ? AND locked_until > ?", []string{g.userKey(username), g.ipKey(ip)}, now).
+		Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := t.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure 记录一次登录失败，userID 为用户名对应的用户（不存在时为 nil）；
+// 这次失败导致锁定时返回锁定时长，并写入审计记录
+func (g *LoginGuard) RecordFailure(username, ip string, userID *uint) (time.Duration, error) {
+	var wait time.Duration
+	for _, target := range []struct {
+		key     string
+		max     int
+		subject string
+		userID  *uint
+	}{
+		{g.userKey(username), g.MaxFailures, username, userID},
+		{g.ipKey(ip), g.MaxIPFailures, ip, nil},
+	} {
+		failures, lock, err := g.fail(target.key, target.max)
+		if err != nil {
+			return 0, err
+		}
+		if lock == 0 {
+			continue
+		}
+		if lock > wait {
+			wait = lock
+		}
+		if err := g.DB.Create(&models.AuditLog{
+			UserID:  target.userID,
+			Event:   g.AuditEvent,
+			Subject: truncate(target.subject, 191),
+			IP:      ip,
+			Detail:  fmt.Sprintf("%s 连续登录失败 %d 次，锁定 %s", target.key, failures, lock),
+		}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return wait, nil
+}
+
+// RecordSuccess 登录成功后清除该用户名的失败计数。
+// IP 的计数不清除，否则攻击者可以用自己的账号登录来重置它，只随窗口期过期
+func (g *LoginGuard) RecordSuccess(username string) error {
+	return g.DB.Where("throttle_key = ?", g.userKey(username)).Delete(&models.LoginThrottle{}).Error
+}
+
+// fail 失败次数加一（距上次失败或锁定到期已超过窗口期时从 1 重新计数），返回失败次数和新的锁定时长
+func (g *LoginGuard) fail(key string, max int) (int, time.Duration, error) {
+	now := time.Now()
+	cutoff := now.Add(-g.Window)
+	// 先尝试原子地更新已有记录，不存在时再创建；并发创建冲突时重试一次更新
+	for i := 0; ; i++ {
+		result := g.DB.Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).Updates(map[string]interface{}{
+			"failures": gorm.Expr("CASE WHEN last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?) THEN 1 ELSE failures + 1 END",
+				cutoff, cutoff),
+			"last_failure_at": now,
+		})
+		if result.Error != nil {
+			return 0, 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			break
+		}
+		err := g.DB.Create(&models.LoginThrottle{ThrottleKey: key, Failures: 1, LastFailureAt: now}).Error
+		if err == nil {
+			break
+		}
+		if i > 0 {
+			return 0, 0, err
+		}
+	}
+
+	var throttle models.LoginThrottle
+	if err := g.DB.Where("throttle_key = ?", key).First(&throttle).Error; err != nil {
+		return 0, 0, err
+	}
+	if max <= 0 || throttle.Failures < max {
+		return throttle.Failures, 0, nil
+	}
+	lock := g.lockout(throttle.Failures - max)
+	err := g.DB.Model(&throttle).Update("locked_until", now.Add(lock)).Error
+	return throttle.Failures, lock, err
+}
+
+// lockout 超出上限 n 次时的锁定时长：Lockout * 2^n，不超过 MaxLockout
+func (g *LoginGuard) lockout(n int) time.Duration {
+	d := g.Lockout
+	for i := 0; i < n && d < g.MaxLockout; i++ {
+		d *= 2
+	}
+	if g.MaxLockout > 0 && d > g.MaxLockout {
+		d = g.MaxLockout
+	}
+	return d
+}
+
+// 用户名不区分大小写，与数据库的默认排序规则一致，避免换大小写绕过限制
+func (g *LoginGuard) userKey(username string) string {
+	return truncate(g.Prefix+"user:"+strings.ToLower(strings.TrimSpace(username)), 191)
+}
+
+func (g *LoginGuard) ipKey(ip string) string {
+	return g.Prefix + "ip:" + ip
+}
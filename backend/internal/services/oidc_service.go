@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("未启用第三方登录")
+	ErrInvalidOIDCState = errors.New("登录请求无效或已过期，请重新登录")
+	ErrInvalidIDToken   = errors.New("身份提供方返回的身份令牌无效")
+	ErrOIDCCodeRejected = errors.New("授权码无效或已过期，请重新登录")
+)
+
+// 审计事件
+const AuditIdentityLinked = "identity_linked"
+
+// 从点击登录到回调完成的时限
+const oidcLoginTTL = 10 * time.Minute
+
+// 遇到未知 kid 时重新获取 JWKS 的最短间隔，kid 来自未经验证的令牌，不能每次都请求
+const jwksMinRefresh = time.Minute
+
+// OIDCClaims ID Token 中用到的声明
+type OIDCClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// OIDCService OpenID Connect 授权码登录（PKCE），按 iss + sub 关联本地用户，
+// 首次登录时通过双方都已验证的邮箱关联已有账号，否则创建新账号
+type OIDCService struct {
+	DB           *gorm.DB
+	Accounts     *AccountService
+	Name         string // 身份提供方的显示名称
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+	keysMu        sync.Mutex // 同一时间只有一个请求获取 JWKS
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDCService(db *gorm.DB, accounts *AccountService, name, issuer, clientID, clientSecret, redirectURL, scopes string) *OIDCService {
+	return &OIDCService{
+		DB:           db,
+		Accounts:     accounts,
+		Name:         name,
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(scopes),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (o *OIDCService) Enabled() bool {
+	return o.Issuer != "" && o.ClientID != ""
+}
+
+// AuthorizeURL 生成跳转到身份提供方的授权地址，返回地址和 state；
+// 前端应保存 state，回调时与地址栏中的比对，防止登录 CSRF
+func (o *OIDCService) AuthorizeURL(ctx context.Context) (string, string, error) {
+	if !o.Enabled() {
+		return "", "", ErrOIDCDisabled
+	}
+	d, err := o.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	// 顺带清理过期的记录
+	o.DB.Where("expires_at < ?", now).Delete(&models.OIDCLogin{})
+	if err := o.DB.Create(&models.OIDCLogin{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+	}).Error; err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.ClientID)
+	q.Set("redirect_uri", o.RedirectURL)
+	q.Set("scope", strings.Join(o.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// Exchange 用回调中的授权码换取并校验 ID Token，state 只能使用一次
+func (o *OIDCService) Exchange(ctx context.Context, code, state string) (*OIDCClaims, error) {
+	if !o.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	var login models.OIDCLogin
+	if err := o.DB.Where("state_hash = ?", hashToken(state)).First(&login).Error; err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	result := o.DB.Where("state_hash = ?", login.StateHash).Delete(&models.OIDCLogin{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(login.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	d, err := o.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.RedirectURL)
+	form.Set("code_verifier", login.CodeVerifier)
+	form.Set("client_id", o.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := o.doJSON(req, &tokenResp)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusBadRequest && tokenResp.Error == "invalid_grant" {
+		return nil, ErrOIDCCodeRejected
+	}
+	if status != http.StatusOK || tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("换取令牌失败: %d %s %s", status, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	return o.verifyIDToken(ctx, tokenResp.IDToken, login.Nonce)
+}
+
+// verifyIDToken 校验签名（RS256）、iss、aud、exp 和 nonce
+func (o *OIDCService) verifyIDToken(ctx context.Context, raw, nonce string) (*OIDCClaims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}))
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.getKey(ctx, kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidIDToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok ||
+		!claims.VerifyIssuer(o.Issuer, true) ||
+		!claims.VerifyAudience(o.ClientID, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) ||
+		claims["nonce"] != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	result := &OIDCClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	// 部分提供方把 email_verified 返回为字符串
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+	if result.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+	return result, nil
+}
+
+// FindOrCreateUser 返回外部身份对应的用户：已关联的直接返回；
+// 否则关联到邮箱相同且双方都已验证的用户；都没有时创建新用户
+func (o *OIDCService) FindOrCreateUser(claims *OIDCClaims, ip string) (*models.User, error) {
+	user, err := o.linkedUser(claims.Subject)
+	if user != nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+	user, err = o.linkIdentity(claims, ip)
+	if err != nil {
+		// 同一身份并发首次登录时，另一个请求可能已创建关联，违反唯一索引；此时使用已有的关联
+		if existing, _ := o.linkedUser(claims.Subject); existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// linkedUser 返回已关联到该外部身份的用户，未关联时返回 gorm.ErrRecordNotFound
+func (o *OIDCService) linkedUser(subject string) (*models.User, error) {
+	var identity models.UserIdentity
+	if err := o.DB.Where("issuer = ? AND subject = ?", o.Issuer, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := o.DB.First(&user, identity.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// linkIdentity 为尚未关联的外部身份关联已有用户或创建新用户
+func (o *OIDCService) linkIdentity(claims *OIDCClaims, ip string) (*models.User, error) {
+	var user models.User
+
+	email, emailErr := NormalizeEmail(claims.Email)
+	verified := emailErr == nil && claims.EmailVerified
+	linked := false
+	if verified {
+		err := o.DB.Where("email = ? AND email_verified = ?", email, true).First(&user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		linked = err == nil
+	}
+
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		if !linked {
+			if err := o.newUser(tx, &user, claims, email, verified); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&models.UserIdentity{
+			UserID:  user.ID,
+			Issuer:  o.Issuer,
+			Subject: claims.Subject,
+			Email:   truncate(claims.Email, 100),
+		}).Error; err != nil {
+			return err
+		}
+		if !linked {
+			return nil
+		}
+		return tx.Create(&models.AuditLog{
+			UserID:  &user.ID,
+			Event:   AuditIdentityLinked,
+			Subject: truncate(o.Issuer+" "+claims.Subject, 191),
+			IP:      ip,
+			Detail:  truncate("通过已验证的邮箱 "+email+" 关联外部账号", 255),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// newUser 为外部身份创建本地用户。密码为随机值，需要时可以通过邮件重置
+func (o *OIDCService) newUser(tx *gorm.DB, user *models.User, claims *OIDCClaims, email string, verified bool) error {
+	base := claims.PreferredUsername
+	if base == "" && email != "" {
+		base = email[:strings.Index(email, "@")]
+	}
+	base = truncate(usernameInvalidChars.ReplaceAllString(base, ""), 40)
+	if base == "" {
+		base = "user"
+	}
+	username, err := availableUsername(tx, base)
+	if err != nil {
+		return err
+	}
+	password, err := newToken()
+	if err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	nickname := truncate(claims.Name, 100)
+	if nickname == "" {
+		nickname = username
+	}
+	*user = models.User{Username: username, Password: string(hashed), Nickname: nickname}
+	if verified {
+		// 邮箱已被其他用户验证时不使用，避免违反唯一约束
+		taken, err := emailTaken(tx, email, 0)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			user.Email = email
+			user.EmailVerified = true
+		}
+	}
+	return tx.Create(user).Error
+}
+
+// availableUsername 用户名已存在时加随机数字后缀
+func availableUsername(tx *gorm.DB, base string) (string, error) {
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, n.Int64())
+	}
+	return "", errors.New("无法生成可用的用户名")
+}
+
+func (o *OIDCService) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d oidcDiscovery
+	status, err := o.doJSON(req, &d)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("获取 OpenID 配置失败: %d", status)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != o.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OpenID 配置与 OIDC_ISSUER 不一致")
+	}
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// getKey 按 kid 查找签名公钥，找不到时重新获取一次 JWKS（身份提供方可能已轮换密钥），
+// 两次获取至少间隔 jwksMinRefresh
+func (o *OIDCService) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	o.keysMu.Lock()
+	defer o.keysMu.Unlock()
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	fetchedAt := o.keysFetchedAt
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !fetchedAt.IsZero() && time.Since(fetchedAt) < jwksMinRefresh {
+		return nil, ErrInvalidIDToken
+	}
+	d, err := o.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	status, err := o.doJSON(req, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("获取 JWKS 失败: %d", status)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	o.mu.Lock()
+	o.keys = keys
+	o.keysFetchedAt = time.Now()
+	o.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// doJSON 发送请求并解析 JSON 响应，返回状态码
+func (o *OIDCService) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// 出错时响应可能不是 JSON，由调用方根据状态码处理
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 返回内存中的 SQLite 数据库，只用一个连接，保证各语句看到同一个库
+func newTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testIssuer 模拟身份提供方，提供 discovery、JWKS 和令牌端点
+type testIssuer struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	mu         sync.Mutex
+	challenges map[string]string // code -> code_challenge
+	nonces     map[string]string // code -> nonce
+	claims     jwt.MapClaims     // 覆盖默认声明，值为 nil 时删除该声明
+	jwksHits   int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key, kid: "k1", challenges: map[string]string{}, nonces: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss.srv.URL,
+			"authorization_endpoint": iss.srv.URL + "/authorize",
+			"token_endpoint":         iss.srv.URL + "/token",
+			"jwks_uri":               iss.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		iss.jwksHits++
+		iss.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		code := r.Form.Get("code")
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		id, secret, _ := r.BasicAuth()
+
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		challenge, ok := iss.challenges[code]
+		delete(iss.challenges, code)
+		if !ok || challenge != base64.RawURLEncoding.EncodeToString(sum[:]) ||
+			r.Form.Get("grant_type") != "authorization_code" || id != "client" || secret != url.QueryEscape("s&cret") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            iss.srv.URL,
+			"aud":            "client",
+			"sub":            "subject-1",
+			"email":          "dee@example.com",
+			"email_verified": true,
+			"nonce":          iss.nonces[code],
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+		for k, v := range iss.claims {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = iss.kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	iss.srv = httptest.NewServer(mux)
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+// authorize 模拟用户在身份提供方登录：记下授权地址中的 PKCE challenge 和 nonce，返回授权码和 state
+func (iss *testIssuer) authorize(t *testing.T, o *OIDCService) (string, string) {
+	t.Helper()
+	authURL, state, err := o.AuthorizeURL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("state") != state || q.Get("redirect_uri") != o.RedirectURL {
+		t.Fatalf("授权地址参数不正确: %s", authURL)
+	}
+	code, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.challenges[code] = q.Get("code_challenge")
+	iss.nonces[code] = q.Get("nonce")
+	iss.mu.Unlock()
+	return code, state
+}
+
+func (iss *testIssuer) setClaims(claims jwt.MapClaims) {
+	iss.mu.Lock()
+	iss.claims = claims
+	iss.mu.Unlock()
+}
+
+func newTestOIDC(t *testing.T, iss *testIssuer) *OIDCService {
+	db := newTestDB(t, &models.User{}, &models.UserIdentity{}, &models.OIDCLogin{}, &models.AuditLog{})
+	accounts := &AccountService{DB: db}
+	return NewOIDCService(db, accounts, "Test", iss.srv.URL+"/", "client", "s&cret", "http://app/oidc/callback", "openid email")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	iss := newTestIssuer(t)
+	o := newTestOIDC(t, iss)
+	ctx := context.Background()
+
+	code, state := iss.authorize(t, o)
+	claims, err := o.Exchange(ctx, code, state)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "dee@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// state 只能使用一次
+	if _, err := o.Exchange(ctx, code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("重复使用 state: err = %v", err)
+	}
+	if _, err := o.Exchange(ctx, code, "unknown"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("未知 state: err = %v", err)
+	}
+
+	// 身份提供方拒绝授权码（如 code_verifier 不匹配）
+	_, state = iss.authorize(t, o)
+	if _, err := o.Exchange(ctx, "wrong-code", state); !errors.Is(err, ErrOIDCCodeRejected) {
+		t.Errorf("错误的授权码: err = %v", err)
+	}
+}
+
+func TestOIDCRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"nonce 不符", jwt.MapClaims{"nonce": "other"}},
+		{"缺少 nonce", jwt.MapClaims{"nonce": nil}},
+		{"aud 不符", jwt.MapClaims{"aud": "other-client"}},
+		{"iss 不符", jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{"已过期", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{"缺少 sub", jwt.MapClaims{"sub": nil}},
+	}
+	iss := newTestIssuer(t)
+	o := newTestOIDC(t, iss)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss.setClaims(tt.claims)
+			code, state := iss.authorize(t, o)
+			if _, err := o.Exchange(context.Background(), code, state); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("err = %v, 期望 ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCUnknownKidRefetchCooldown(t *testing.T) {
+	iss := newTestIssuer(t)
+	o := newTestOIDC(t, iss)
+	ctx := context.Background()
+
+	code, state := iss.authorize(t, o)
+	if _, err := o.Exchange(ctx, code, state); err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.kid = "unknown"
+	iss.mu.Unlock()
+	for i := 0; i < 5; i++ {
+		code, state := iss.authorize(t, o)
+		if _, err := o.Exchange(ctx, code, state); !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("未知 kid: err = %v", err)
+		}
+	}
+	if iss.jwksHits != 1 {
+		t.Errorf("JWKS 请求了 %d 次，冷却期内应只请求一次", iss.jwksHits)
+	}
+
+	// 冷却期过后允许重新获取
+	o.keysFetchedAt = time.Now().Add(-2 * jwksMinRefresh)
+	code, state = iss.authorize(t, o)
+	o.Exchange(ctx, code, state)
+	if iss.jwksHits != 2 {
+		t.Errorf("冷却期后 JWKS 请求次数 = %d", iss.jwksHits)
+	}
+}
+
+func TestOIDCFindOrCreateUser(t *testing.T) {
+	iss := newTestIssuer(t)
+	o := newTestOIDC(t, iss)
+	existing := models.User{Username: "dee", Password: "x", Email: "dee@example.com", EmailVerified: true}
+	if err := o.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 邮箱未验证：不关联已有账号，创建新用户且不使用该邮箱
+	user, err := o.FindOrCreateUser(&OIDCClaims{Subject: "s-unverified", Email: "dee@example.com", PreferredUsername: "dee"}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == existing.ID || user.Email != "" || user.Username == "dee" {
+		t.Errorf("未验证邮箱应创建新用户: %+v", user)
+	}
+
+	// 邮箱已验证：关联已有账号并写审计日志
+	user, err = o.FindOrCreateUser(&OIDCClaims{Subject: "s-verified", Email: "dee@example.com", EmailVerified: true}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("已验证邮箱应关联到用户 %d，实际 %d", existing.ID, user.ID)
+	}
+	var logs int64
+	o.DB.Model(&models.AuditLog{}).Where("user_id = ? AND event = ?", existing.ID, AuditIdentityLinked).Count(&logs)
+	if logs != 1 {
+		t.Errorf("审计日志条数 = %d", logs)
+	}
+
+	// 再次登录直接返回已关联的用户，即使邮箱已变化
+	again, err := o.FindOrCreateUser(&OIDCClaims{Subject: "s-verified", Email: "new@example.com", EmailVerified: true}, "127.0.0.1")
+	if err != nil || again.ID != existing.ID {
+		t.Errorf("再次登录: user = %+v, err = %v", again, err)
+	}
+
+	// 新的外部身份，邮箱已验证但本地没有对应用户：创建新用户并使用该邮箱
+	fresh, err := o.FindOrCreateUser(&OIDCClaims{Subject: "s-new", Email: "fresh@example.com", EmailVerified: true, Name: "Fresh"}, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Email != "fresh@example.com" || !fresh.EmailVerified || fresh.Username != "fresh" || fresh.Nickname != "Fresh" {
+		t.Errorf("新用户: %+v", fresh)
+	}
+}
+
+func TestOIDCConcurrentFirstLogin(t *testing.T) {
+	iss := newTestIssuer(t)
+	o := newTestOIDC(t, iss)
+	winner := models.User{Username: "winner", Password: "x"}
+	if err := o.DB.Create(&winner).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟另一个请求在本次查询关联之后、创建关联之前完成了首次登录
+	raced := false
+	o.DB.Callback().Query().After("gorm:query").Register("test:race", func(db *gorm.DB) {
+		if raced || db.Statement.Table != "user_identities" || db.RowsAffected != 0 {
+			return
+		}
+		raced = true
+		if err := o.DB.Create(&models.UserIdentity{
+			UserID: winner.ID, Issuer: o.Issuer, Subject: "same-sub",
+		}).Error; err != nil {
+			t.Error(err)
+		}
+	})
+
+	user, err := o.FindOrCreateUser(&OIDCClaims{Subject: "same-sub", Email: "x@example.com"}, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("并发首次登录应使用已有关联: %v", err)
+	}
+	if !raced || user.ID != winner.ID {
+		t.Errorf("user = %d, 期望 %d", user.ID, winner.ID)
+	}
+	var users int64
+	o.DB.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("失败的登录不应留下新用户，用户数 = %d", users)
+	}
+}
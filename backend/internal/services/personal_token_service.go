@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 个人访问令牌的前缀，用于和 JWT 区分，也便于在代码仓库等地方扫描泄露的令牌
+const PersonalTokenPrefix = "pat_"
+
+// 个人访问令牌的权限。令牌只能访问声明了权限的接口，账号、会话和令牌管理等接口只接受登录会话
+const (
+	ScopeTasksRead  = "tasks:read"  // 查看任务、子任务、附件、标签和分类
+	ScopeTasksWrite = "tasks:write" // 修改以上数据
+	ScopeUserRead   = "user:read"   // 查看个人资料和存储用量
+)
+
+var AllScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeUserRead}
+
+// DefaultScopes 未指定权限时创建只读令牌，写权限必须显式申请
+var DefaultScopes = []string{ScopeTasksRead, ScopeUserRead}
+
+var (
+	ErrInvalidScope         = errors.New("未知的令牌权限")
+	ErrInvalidPersonalToken = errors.New("访问令牌无效、已过期或已撤销")
+)
+
+// PersonalTokenService 创建、撤销和校验个人访问令牌
+type PersonalTokenService struct {
+	DB *gorm.DB
+}
+
+func NewPersonalTokenService(db *gorm.DB) *PersonalTokenService {
+	return &PersonalTokenService{DB: db}
+}
+
+// Create 创建令牌，返回的明文令牌只在此时可见；scopes 为空时只有只读权限（DefaultScopes），
+// 包含未知的权限时返回 ErrInvalidScope，expiresAt 为空时不过期
+func (p *PersonalTokenService) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	random, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := PersonalTokenPrefix + random
+	record := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      truncate(strings.TrimSpace(name), 100),
+		Prefix:    token[:len(PersonalTokenPrefix)+6],
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(dedupe(scopes), " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := p.DB.Create(record).Error; err != nil {
+		return nil, "", err
+	}
+	return record, token, nil
+}
+
+// List 用户未撤销的令牌，包括已过期的，最新创建的在前
+func (p *PersonalTokenService) List(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := p.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke 撤销用户自己的令牌，令牌不存在时返回 gorm.ErrRecordNotFound
+func (p *PersonalTokenService) Revoke(userID, tokenID uint) error {
+	result := p.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// revokeUserTokens 在给定的事务中撤销用户的所有令牌，如重置密码后
+func revokeUserTokens(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate 校验令牌，返回对应的记录
+func (p *PersonalTokenService) Authenticate(token string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, PersonalTokenPrefix) {
+		return nil, ErrInvalidPersonalToken
+	}
+	var record models.PersonalAccessToken
+	if err := p.DB.Where("token_hash = ? AND revoked_at IS NULL", hashToken(token)).First(&record).Error; err != nil {
+		return nil, ErrInvalidPersonalToken
+	}
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil, ErrInvalidPersonalToken
+	}
+	// 与会话一样，最后使用时间最多每分钟更新一次
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > sessionTouchInterval {
+		p.DB.Model(&record).Update("last_used_at", now)
+	}
+	return &record, nil
+}
+
+// HasScopes 令牌是否拥有全部 scopes 权限
+func HasScopes(token *models.PersonalAccessToken, scopes ...string) bool {
+	granted := strings.Fields(token.Scopes)
+	for _, scope := range scopes {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func validScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
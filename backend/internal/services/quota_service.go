@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrQuotaExceeded = errors.New("存储空间不足")
+
+// StorageUsage 用户的存储用量（字节），按类型分别统计
+type StorageUsage struct {
+	Attachments int64 `json:"attachments"`
+	Avatar      int64 `json:"avatar"`
+	Background  int64 `json:"background"`
+	Pending     int64 `json:"pending"` // 未完成的断点续传预留的空间
+}
+
+func (u StorageUsage) Total() int64 {
+	return u.Attachments + u.Avatar + u.Background + u.Pending
+}
+
+// GetStorageUsage 统计用户的附件（含回收站中的任务）、头像、背景图片占用的空间，
+// 以及未完成的断点续传按声明的大小预留的空间
+func GetStorageUsage(db *gorm.DB, userID uint) (StorageUsage, error) {
+	var usage StorageUsage
+	if err := db.Model(&models.TaskResource{}).
+		Joins("JOIN tasks ON tasks.id = task_resources.task_id").
+		Where("tasks.user_id = ?", userID).
+		Select("COALESCE(SUM(task_resources.file_size), 0)").
+		Scan(&usage.Attachments).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", userID).
+		Select("avatar_size").Scan(&usage.Avatar).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.UserSetting{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(background_size), 0)").Scan(&usage.Background).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.UploadSession{}).Where("user_id = ? AND resource_id IS NULL", userID).
+		Select("COALESCE(SUM(upload_length), 0)").Scan(&usage.Pending).Error; err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// UserQuota 用户的存储配额（字节），优先使用单独设置的配额，0 表示不限制
+func (s *UploadService) UserQuota(db *gorm.DB, userID uint) (int64, error) {
+	var user models.User
+	if err := db.Select("id", "storage_quota_mb").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.StorageQuotaMB != nil {
+		return int64(*user.StorageQuotaMB) << 20, nil
+	}
+	return s.Quota, nil
+}
+
+// CommitWithinQuota 在事务中执行 fn（保存新文件的记录），然后重新统计用量，超出配额时回滚。
+// 事务开始时锁定用户行，同一用户的并发上传依次提交，不会各自通过检查后合计超出配额
+func (s *UploadService) CommitWithinQuota(db *gorm.DB, userID uint, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return s.CheckQuota(tx, userID, 0, 0)
+	})
+}
+
+// CheckQuota 检查新增 add 字节（同时释放 release 字节）后是否超出配额
+func (s *UploadService) CheckQuota(db *gorm.DB, userID uint, add, release int64) error {
+	quota, err := s.UserQuota(db, userID)
+	if err != nil || quota <= 0 {
+		return err
+	}
+	usage, err := GetStorageUsage(db, userID)
+	if err != nil {
+		return err
+	}
+	if usage.Total()-release+add > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的重复频率
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// 计算下一次发生时间时最多向后查找的周期数，防止规则无解时死循环
+const maxRecurrenceSteps = 1000
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RecurrenceRule RRULE 的子集：FREQ、INTERVAL、BYDAY（仅每周）、BYMONTHDAY（仅每月）、UNTIL、COUNT
+type RecurrenceRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay int // 每月的第几天，-1 表示最后一天，0 表示与开始日期相同
+	Until      *time.Time
+	Count      int // 总次数（含第一次），0 表示不限
+}
+
+// ParseRecurrenceRule 解析 RRULE 字符串，例如 "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10"。
+// UNTIL 只有日期时按 loc 时区当天结束计算。
+func ParseRecurrenceRule(s string, loc *time.Location) (*RecurrenceRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("重复规则不能为空")
+	}
+
+	rule := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("重复规则格式错误: %s", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			switch value {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+				rule.Freq = value
+			default:
+				return nil, fmt.Errorf("不支持的重复频率: %s", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("INTERVAL 必须为正整数")
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY 格式错误: %s", code)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n == 0 || n > 31 || n < -1 {
+				return nil, errors.New("BYMONTHDAY 必须为 1-31 或 -1")
+			}
+			rule.ByMonthDay = n
+		case "UNTIL":
+			until, err := parseUntil(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("COUNT 必须为正整数")
+			}
+			rule.Count = n
+		default:
+			return nil, fmt.Errorf("不支持的重复规则字段: %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("重复规则缺少 FREQ")
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != FreqWeekly {
+		return nil, errors.New("BYDAY 仅支持每周重复")
+	}
+	if rule.ByMonthDay != 0 && rule.Freq != FreqMonthly {
+		return nil, errors.New("BYMONTHDAY 仅支持每月重复")
+	}
+	if rule.Until != nil && rule.Count > 0 {
+		return nil, errors.New("UNTIL 和 COUNT 不能同时使用")
+	}
+	return rule, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, errors.New("UNTIL 格式错误")
+}
+
+// Next 返回 start 开始的序列中晚于 after 的下一次发生时间，n 为 after 对应的次数（第一次为 1）。
+// 超出 UNTIL 或 COUNT 限制时返回 false。计算按 loc 时区的日历进行，保留 start 的时刻。
+func (r *RecurrenceRule) Next(start, after time.Time, n int, loc *time.Location) (time.Time, bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+
+	start = start.In(loc)
+	after = after.In(loc)
+	var next time.Time
+	var ok bool
+	switch r.Freq {
+	case FreqDaily:
+		next, ok = r.nextDaily(start, after)
+	case FreqWeekly:
+		next, ok = r.nextWeekly(start, after)
+	case FreqMonthly:
+		next, ok = r.nextMonthly(start, after)
+	case FreqYearly:
+		next, ok = r.nextYearly(start, after)
+	}
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r *RecurrenceRule) nextDaily(start, after time.Time) (time.Time, bool) {
+	// 先按经过的天数估算，再逐步向后查找
+	first := 0
+	if elapsed := int(after.Sub(start).Hours() / 24); elapsed > 0 {
+		first = elapsed / r.Interval
+	}
+	for i := first; i <= first+maxRecurrenceSteps; i++ {
+		if t := start.AddDate(0, 0, i*r.Interval); t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *RecurrenceRule) nextWeekly(start, after time.Time) (time.Time, bool) {
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	startWeek := StartOfWeek(start, start.Location())
+
+	// 从 after 当天开始逐日检查，只接受与开始周相差 INTERVAL 整数倍的周
+	day := StartOfDay(after, after.Location())
+	if day.Before(StartOfDay(start, start.Location())) {
+		day = StartOfDay(start, start.Location())
+	}
+	for i := 0; i <= 7*r.Interval*2+7; i++ {
+		d := day.AddDate(0, 0, i)
+		weeks := int(StartOfWeek(d, d.Location()).Sub(startWeek).Hours()/24+0.5) / 7
+		if weeks%r.Interval != 0 || !containsWeekday(days, d.Weekday()) {
+			continue
+		}
+		t := time.Date(d.Year(), d.Month(), d.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		if t.After(after) && !t.Before(start) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *RecurrenceRule) nextMonthly(start, after time.Time) (time.Time, bool) {
+	monthDay := r.ByMonthDay
+	if monthDay == 0 {
+		monthDay = start.Day()
+	}
+	// 从 after 所在月份之前最近的对齐月份开始
+	elapsed := (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+	first := 0
+	if elapsed > 0 {
+		first = elapsed / r.Interval
+	}
+	for i := first; i <= first+maxRecurrenceSteps; i++ {
+		month := time.Date(start.Year(), start.Month()+time.Month(i*r.Interval), 1, 0, 0, 0, 0, start.Location())
+		lastDay := month.AddDate(0, 1, -1).Day()
+		day := monthDay
+		if day == -1 {
+			day = lastDay
+		}
+		// 当月没有这一天时跳过（例如 31 日）
+		if day > lastDay {
+			continue
+		}
+		t := time.Date(month.Year(), month.Month(), day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		if t.After(after) && !t.Before(start) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *RecurrenceRule) nextYearly(start, after time.Time) (time.Time, bool) {
+	first := 0
+	if elapsed := after.Year() - start.Year(); elapsed > 0 {
+		first = elapsed / r.Interval
+	}
+	for i := first; i <= first+maxRecurrenceSteps; i++ {
+		year := start.Year() + i*r.Interval
+		t := time.Date(year, start.Month(), start.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		// 2 月 29 日在非闰年跳过
+		if t.Month() != start.Month() {
+			continue
+		}
+		if t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// occurrences 从 start 开始依次计算，最多返回 max 次发生时间（含第一次）
+func occurrences(t *testing.T, rule string, start time.Time, max int) []string {
+	t.Helper()
+	r, err := ParseRecurrenceRule(rule, start.Location())
+	if err != nil {
+		t.Fatalf("ParseRecurrenceRule(%q): %v", rule, err)
+	}
+	result := []string{start.Format("2006-01-02 15:04")}
+	for cur, n := start, 1; len(result) < max; n++ {
+		next, ok := r.Next(start, cur, n, start.Location())
+		if !ok {
+			break
+		}
+		result = append(result, next.Format("2006-01-02 15:04"))
+		cur = next
+	}
+	return result
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name  string
+		rule  string
+		start string
+		max   int
+		want  []string
+	}{
+		{
+			name: "每两天", rule: "FREQ=DAILY;INTERVAL=2", start: "2026-01-30 09:00", max: 4,
+			want: []string{"2026-01-30 09:00", "2026-02-01 09:00", "2026-02-03 09:00", "2026-02-05 09:00"},
+		},
+		{
+			name: "BYDAY 每周一三五", rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR", start: "2026-01-07 09:00", max: 5,
+			want: []string{"2026-01-07 09:00", "2026-01-09 09:00", "2026-01-12 09:00", "2026-01-14 09:00", "2026-01-16 09:00"},
+		},
+		{
+			name: "BYDAY 隔周二四", rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", start: "2026-01-06 08:30", max: 5,
+			want: []string{"2026-01-06 08:30", "2026-01-08 08:30", "2026-01-20 08:30", "2026-01-22 08:30", "2026-02-03 08:30"},
+		},
+		{
+			name: "每周不带 BYDAY 按开始日期的星期", rule: "FREQ=WEEKLY", start: "2026-01-04 20:00", max: 3,
+			want: []string{"2026-01-04 20:00", "2026-01-11 20:00", "2026-01-18 20:00"},
+		},
+		{
+			name: "BYMONTHDAY 每季度 15 日", rule: "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=15", start: "2026-01-15 10:00", max: 4,
+			want: []string{"2026-01-15 10:00", "2026-04-15 10:00", "2026-07-15 10:00", "2026-10-15 10:00"},
+		},
+		{
+			name: "BYMONTHDAY=-1 每月最后一天", rule: "FREQ=MONTHLY;BYMONTHDAY=-1", start: "2026-01-31 18:00", max: 4,
+			want: []string{"2026-01-31 18:00", "2026-02-28 18:00", "2026-03-31 18:00", "2026-04-30 18:00"},
+		},
+		{
+			name: "月末 31 日跳过没有 31 日的月份", rule: "FREQ=MONTHLY", start: "2026-01-31 18:00", max: 4,
+			want: []string{"2026-01-31 18:00", "2026-03-31 18:00", "2026-05-31 18:00", "2026-07-31 18:00"},
+		},
+		{
+			name: "闰年 2 月 29 日", rule: "FREQ=YEARLY", start: "2024-02-29 08:00", max: 3,
+			want: []string{"2024-02-29 08:00", "2028-02-29 08:00", "2032-02-29 08:00"},
+		},
+		{
+			name: "COUNT 含第一次", rule: "FREQ=DAILY;COUNT=3", start: "2026-01-01 09:00", max: 10,
+			want: []string{"2026-01-01 09:00", "2026-01-02 09:00", "2026-01-03 09:00"},
+		},
+		{
+			name: "UNTIL 只有日期时包含当天", rule: "FREQ=WEEKLY;UNTIL=20260115", start: "2026-01-01 23:00", max: 10,
+			want: []string{"2026-01-01 23:00", "2026-01-08 23:00", "2026-01-15 23:00"},
+		},
+		{
+			name: "UNTIL 为 UTC 时刻", rule: "FREQ=WEEKLY;UNTIL=20260114T235959Z", start: "2026-01-08 09:00", max: 10,
+			want: []string{"2026-01-08 09:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrences(t, tt.rule, at(tt.start), tt.max)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v\nwant %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v\nwant %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// 从序列中间的某个时间开始查找，结果与逐次计算一致
+func TestRecurrenceNextFromArbitraryTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	start := time.Date(2026, 1, 31, 9, 0, 0, 0, loc)
+	r, err := ParseRecurrenceRule("FREQ=MONTHLY;BYMONTHDAY=-1", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, ok := r.Next(start, time.Date(2026, 6, 10, 0, 0, 0, 0, loc), 5, loc)
+	if !ok || !next.Equal(time.Date(2026, 6, 30, 9, 0, 0, 0, loc)) {
+		t.Errorf("Next = %v, %v", next, ok)
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=3;UNTIL=20260101",
+		"FREQ=DAILY;UNTIL=2026-01-01",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ",
+	} {
+		if _, err := ParseRecurrenceRule(rule, time.UTC); err == nil {
+			t.Errorf("ParseRecurrenceRule(%q) 应返回错误", rule)
+		}
+	}
+
+	r, err := ParseRecurrenceRule("RRULE:freq=weekly;byday=mo,fr;interval=2", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Freq != FreqWeekly || r.Interval != 2 || len(r.ByDay) != 2 || r.ByDay[0] != time.Monday || r.ByDay[1] != time.Friday {
+		t.Errorf("rule = %+v", r)
+	}
+}
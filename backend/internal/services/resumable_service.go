@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUploadOffsetMismatch = errors.New("上传偏移量不一致")
+	ErrUploadLocked         = errors.New("该上传正在处理中")
+	ErrUploadIncomplete     = errors.New("文件尚未上传完成")
+	ErrTooManyUploads       = errors.New("未完成的上传过多，请先完成或取消部分上传")
+)
+
+// 每个用户同时未完成的上传数量上限，避免大量未完成的数据占满临时目录
+const maxOpenUploads = 10
+
+// ResumableUploads 断点续传（兼容 tus 协议的核心部分）：
+// 先创建上传，再分块追加数据，中断后可查询已接收的偏移量继续上传，全部接收后保存为任务附件
+type ResumableUploads struct {
+	Uploads *UploadService
+	Dir     string        // 未完成数据的临时目录，文件名为上传 ID
+	MaxSize int64         // 单个文件的大小上限，字节
+	Expiry  time.Duration // 超过该时长未更新的上传会被清理
+
+	locks sync.Map // 正在处理的上传 ID，同一上传的请求不能并发
+}
+
+func NewResumableUploads(uploads *UploadService, dir string, maxSize int64, expiry time.Duration) (*ResumableUploads, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &ResumableUploads{Uploads: uploads, Dir: dir, MaxSize: maxSize, Expiry: expiry}, nil
+}
+
+// Create 创建上传，按声明的大小预留配额，预留的空间在完成、取消或过期清理后释放
+func (r *ResumableUploads) Create(db *gorm.DB, userID, taskID uint, fileName string, length int64) (*models.UploadSession, error) {
+	if r.MaxSize > 0 && length > r.MaxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	id, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(r.path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	session := &models.UploadSession{
+		ID:           id,
+		UserID:       userID,
+		TaskID:       taskID,
+		FileName:     fileName,
+		UploadLength: length,
+	}
+	err = r.Uploads.CommitWithinQuota(db, userID, func(tx *gorm.DB) error {
+		var open int64
+		if err := tx.Model(&models.UploadSession{}).
+			Where("user_id = ? AND resource_id IS NULL", userID).Count(&open).Error; err != nil {
+			return err
+		}
+		if open >= maxOpenUploads {
+			return ErrTooManyUploads
+		}
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		os.Remove(r.path(id))
+		return nil, err
+	}
+	return session, nil
+}
+
+// Append 从 offset 处追加数据，offset 必须等于已接收的字节数；
+// 连接中断时已写入的部分同样计入偏移量，返回新的偏移量
+func (r *ResumableUploads) Append(db *gorm.DB, session *models.UploadSession, offset int64, body io.Reader) (int64, error) {
+	unlock, ok := r.lock(session.ID)
+	if !ok {
+		return 0, ErrUploadLocked
+	}
+	defer unlock()
+
+	if err := db.First(session, "id = ?", session.ID).Error; err != nil {
+		return 0, err
+	}
+	if session.ResourceID != nil || offset != session.UploadOffset {
+		return session.UploadOffset, ErrUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(r.path(session.ID), os.O_WRONLY, 0o600)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	// 丢弃上次失败时可能残留的、未计入偏移量的数据
+	if err := f.Truncate(offset); err != nil {
+		return offset, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(body, session.UploadLength-offset))
+	if n > 0 {
+		if err := db.Model(session).Update("upload_offset", offset+n).Error; err != nil {
+			return offset, err
+		}
+	}
+	return offset + n, copyErr
+}
+
+// Finish 将接收完成的文件保存为任务附件；重复调用返回已生成的附件
+func (r *ResumableUploads) Finish(ctx context.Context, db *gorm.DB, session *models.UploadSession) (*models.TaskResource, error) {
+	unlock, ok := r.lock(session.ID)
+	if !ok {
+		return nil, ErrUploadLocked
+	}
+	defer unlock()
+
+	if err := db.First(session, "id = ?", session.ID).Error; err != nil {
+		return nil, err
+	}
+	var resource models.TaskResource
+	if session.ResourceID != nil {
+		if err := db.First(&resource, *session.ResourceID).Error; err != nil {
+			return nil, err
+		}
+		return &resource, nil
+	}
+	if session.UploadOffset < session.UploadLength {
+		return nil, ErrUploadIncomplete
+	}
+
+	blob, err := prepareBlob(session.FileName, r.MaxSize, func() (io.ReadCloser, error) {
+		return os.Open(r.path(session.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Uploads.CommitBlobs(ctx, db, []*PendingBlob{blob}, func() error {
+		return r.Uploads.CommitWithinQuota(db, session.UserID, func(tx *gorm.DB) error {
+			if err := AcquireBlob(tx, blob); err != nil {
+				return err
+			}
+			resource = models.TaskResource{
+				TaskID:      session.TaskID,
+				FileName:    session.FileName,
+				FilePath:    blob.Key,
+				FileSize:    blob.Size,
+				ContentType: blob.ContentType,
+				BlobSHA256:  blob.SHA256,
+			}
+			if err := tx.Create(&resource).Error; err != nil {
+				return err
+			}
+			return tx.Model(session).Update("resource_id", resource.ID).Error
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(r.path(session.ID))
+	return &resource, nil
+}
+
+// Abort 取消上传并删除已接收的数据
+func (r *ResumableUploads) Abort(db *gorm.DB, session *models.UploadSession) error {
+	unlock, ok := r.lock(session.ID)
+	if !ok {
+		return ErrUploadLocked
+	}
+	defer unlock()
+
+	if err := db.Delete(session).Error; err != nil {
+		return err
+	}
+	if err := os.Remove(r.path(session.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CleanupStale 删除超过有效期未更新的上传及临时目录中的过期文件，返回删除的上传数量
+func (r *ResumableUploads) CleanupStale(db *gorm.DB) (int, error) {
+	cutoff := time.Now().Add(-r.Expiry)
+	result := db.Where("updated_at < ?", cutoff).Delete(&models.UploadSession{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	// 正在上传的文件修改时间会随写入更新，过期的文件即没有对应的有效上传
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		return int(result.RowsAffected), err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if _, locked := r.locks.Load(entry.Name()); locked {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.Dir, entry.Name())); err != nil {
+			log.Printf("删除过期上传文件 %s 失败: %v", entry.Name(), err)
+		}
+	}
+	return int(result.RowsAffected), nil
+}
+
+// RunCleaner 定期清理过期的上传，直到 ctx 被取消
+func (r *ResumableUploads) RunCleaner(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.CleanupStale(db)
+		if err != nil {
+			log.Printf("清理过期上传失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已清理 %d 个过期的未完成上传", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *ResumableUploads) path(id string) string {
+	return filepath.Join(r.Dir, id)
+}
+
+// lock 占用上传 ID，已被占用时返回 false
+func (r *ResumableUploads) lock(id string) (func(), bool) {
+	if _, loaded := r.locks.LoadOrStore(id, struct{}{}); loaded {
+		return nil, false
+	}
+	return func() { r.locks.Delete(id) }, true
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// StartSeries 为任务设置重复规则，任务本身作为序列的第一次
+func StartSeries(tx *gorm.DB, task *models.Task, ruleText string, loc *time.Location) error {
+	if task.DueDate == nil {
+		return errors.New("重复任务必须设置截止日期")
+	}
+	if _, err := ParseRecurrenceRule(ruleText, loc); err != nil {
+		return err
+	}
+
+	series := models.TaskSeries{
+		UserID:           task.UserID,
+		Rule:             ruleText,
+		StartAt:          *task.DueDate,
+		Occurrences:      1,
+		LastOccurrenceAt: *task.DueDate,
+	}
+	copyTemplate(&series, task)
+	if err := tx.Omit("Tags.*").Create(&series).Error; err != nil {
+		return err
+	}
+
+	occurrenceAt := *task.DueDate
+	task.SeriesID = &series.ID
+	task.OccurrenceAt = &occurrenceAt
+	return tx.Model(task).Updates(map[string]interface{}{"series_id": series.ID, "occurrence_at": occurrenceAt}).Error
+}
+
+// ChangeSeriesRule 修改重复规则，从任务当前这一次重新开始计算，规则为空时停止重复
+func ChangeSeriesRule(tx *gorm.DB, task *models.Task, ruleText string, loc *time.Location) error {
+	var series models.TaskSeries
+	if err := tx.First(&series, *task.SeriesID).Error; err != nil {
+		return err
+	}
+	if ruleText == "" {
+		series.Ended = true
+		return tx.Omit("Tags").Save(&series).Error
+	}
+	if _, err := ParseRecurrenceRule(ruleText, loc); err != nil {
+		return err
+	}
+	if task.OccurrenceAt == nil {
+		task.OccurrenceAt = task.DueDate
+	}
+	series.Rule = ruleText
+	series.StartAt = *task.OccurrenceAt
+	series.LastOccurrenceAt = *task.OccurrenceAt
+	series.Occurrences = 1
+	series.Ended = false
+	return tx.Omit("Tags").Save(&series).Error
+}
+
+// UpdateSeriesTemplate 将任务当前内容写回序列模板，用于修改整个序列。
+// rebase 为 true 时以任务新的截止日期作为后续计算的基准。
+func UpdateSeriesTemplate(tx *gorm.DB, task *models.Task, rebase bool) error {
+	var series models.TaskSeries
+	if err := tx.First(&series, *task.SeriesID).Error; err != nil {
+		return err
+	}
+	copyTemplate(&series, task)
+	if rebase && task.DueDate != nil {
+		occurrenceAt := *task.DueDate
+		series.StartAt = occurrenceAt
+		series.LastOccurrenceAt = occurrenceAt
+		task.OccurrenceAt = &occurrenceAt
+		if err := tx.Model(task).Update("occurrence_at", occurrenceAt).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Omit("Tags").Save(&series).Error; err != nil {
+		return err
+	}
+	return tx.Model(&series).Omit("Tags.*").Association("Tags").Replace(series.Tags)
+}
+
+// AdvanceSeries 在重复任务的一次完成或取消后生成下一次，返回新任务。
+// 只有序列中最新的一次会触发生成；序列已结束时返回 nil。
+func AdvanceSeries(tx *gorm.DB, task *models.Task, loc *time.Location) (*models.Task, error) {
+	if task.SeriesID == nil || task.OccurrenceAt == nil {
+		return nil, nil
+	}
+
+	var series models.TaskSeries
+	if err := tx.Preload("Tags").First(&series, *task.SeriesID).Error; err != nil {
+		return nil, err
+	}
+	if series.Ended {
+		return nil, nil
+	}
+
+	// 重新打开旧的一次再完成时不重复生成
+	var newer int64
+	if err := tx.Model(&models.Task{}).Where("series_id = ? AND occurrence_at > ?", series.ID, *task.OccurrenceAt).Count(&newer).Error; err != nil {
+		return nil, err
+	}
+	if newer > 0 {
+		return nil, nil
+	}
+
+	rule, err := ParseRecurrenceRule(series.Rule, loc)
+	if err != nil {
+		return nil, err
+	}
+	next, ok := rule.Next(series.StartAt, series.LastOccurrenceAt, series.Occurrences, loc)
+	if !ok {
+		series.Ended = true
+		return nil, tx.Omit("Tags").Save(&series).Error
+	}
+
+	occurrence := models.Task{
+		Title:        series.Title,
+		Description:  series.Description,
+		DueDate:      &next,
+		AllDay:       series.AllDay,
+		CategoryID:   series.CategoryID,
+		Tags:         series.Tags,
+		Priority:     series.Priority,
+		Status:       models.TaskStatusTodo,
+		UserID:       series.UserID,
+		SeriesID:     &series.ID,
+		OccurrenceAt: &next,
+	}
+	if err := tx.Omit("Tags.*").Create(&occurrence).Error; err != nil {
+		return nil, err
+	}
+
+	// 检查项沿用上一次的内容，全部重置为未完成
+	var subtasks []models.Subtask
+	if err := tx.Where("task_id = ?", task.ID).Order("sort_order asc, id asc").Find(&subtasks).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range subtasks {
+		item := models.Subtask{TaskID: occurrence.ID, Title: s.Title, SortOrder: s.SortOrder}
+		if err := tx.Create(&item).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	series.Occurrences++
+	series.LastOccurrenceAt = next
+	if err := tx.Omit("Tags").Save(&series).Error; err != nil {
+		return nil, err
+	}
+	return &occurrence, nil
+}
+
+func copyTemplate(series *models.TaskSeries, task *models.Task) {
+	series.Title = task.Title
+	series.Description = task.Description
+	series.Priority = task.Priority
+	series.CategoryID = task.CategoryID
+	series.AllDay = task.AllDay
+	series.Tags = task.Tags
+}
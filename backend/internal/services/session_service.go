@@ -0,0 +1,288 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken        = errors.New("无效token")
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，会话已注销")
+)
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // 访问令牌的有效秒数
+}
+
+// SessionService 签发短期访问令牌（HS256 JWT，带会话 sid）和服务端保存的轮换刷新令牌
+type SessionService struct {
+	DB         *gorm.DB
+	Secret     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func NewSessionService(db *gorm.DB, secret string, accessTTL, refreshTTL time.Duration) *SessionService {
+	return &SessionService{DB: db, Secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL}
+}
+
+// 最后活跃时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// Login 为用户创建新会话并签发令牌，记录登录设备的 User-Agent 和 IP
+func (s *SessionService) Login(userID uint, userAgent, ip string) (*TokenPair, error) {
+	id, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  truncate(userAgent, 255),
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.RefreshTTL),
+	}
+	var refresh string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		refresh, err = s.createRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenPair(&session, refresh)
+}
+
+// Refresh 用刷新令牌换取新的令牌，旧的刷新令牌随即失效；
+// 已失效的令牌被再次使用时注销整个会话，使同一令牌族的令牌全部失效
+func (s *SessionService) Refresh(token, ip string) (*TokenPair, error) {
+	var old models.RefreshToken
+	if err := s.DB.Where("token_hash = ?", hashToken(token)).First(&old).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if old.UsedAt != nil {
+		s.Revoke(old.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	var session models.Session
+	if err := s.DB.Where("id = ?", old.SessionID).First(&session).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(old.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var refresh string
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新，并发使用同一令牌时只有一个请求能成功
+		result := tx.Model(&old).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		// 会话的有效期随刷新顺延
+		session.ExpiresAt = now.Add(s.RefreshTTL)
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"expires_at":   session.ExpiresAt,
+			"last_seen_at": now,
+			"ip":           ip,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		refresh, err = s.createRefreshToken(tx, &session)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		s.Revoke(session.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenPair(&session, refresh)
+}
+
+// Revoke 注销会话，其访问令牌和刷新令牌立即失效
+func (s *SessionService) Revoke(sessionID string) error {
+	return s.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate 校验访问令牌及其会话，返回用户 ID 和会话 ID
+func (s *SessionService) Authenticate(tokenString string) (uint, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(s.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, "", ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, "", ErrInvalidToken
+	}
+	userID, ok := claims["userID"].(float64)
+	if !ok {
+		return 0, "", ErrInvalidToken
+	}
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return 0, "", ErrInvalidToken
+	}
+
+	var session models.Session
+	if err := s.DB.Select("id", "last_seen_at").
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sid, uint(userID)).
+		First(&session).Error; err != nil {
+		return 0, "", ErrInvalidToken
+	}
+	if now := time.Now(); now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		s.DB.Model(&session).Update("last_seen_at", now)
+	}
+	return uint(userID), sid, nil
+}
+
+// ListSessions 用户当前有效的会话，最近活跃的在前
+func (s *SessionService) ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession 注销用户自己的某个会话，会话不存在时返回 gorm.ErrRecordNotFound
+func (s *SessionService) RevokeUserSession(userID uint, sessionID string) error {
+	result := s.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions 注销用户除 currentID 以外的所有会话，返回注销的数量
+func (s *SessionService) RevokeOtherSessions(userID uint, currentID string) (int64, error) {
+	result := s.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, currentID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RevokeAllSessions 注销用户的所有会话，如重置密码后
+func (s *SessionService) RevokeAllSessions(userID uint) error {
+	return revokeUserSessions(s.DB, userID)
+}
+
+// revokeUserSessions 在给定的事务中注销用户的所有会话
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// DescribeDevice 从 User-Agent 中粗略识别浏览器和操作系统，用于会话列表展示
+func DescribeDevice(userAgent string) string {
+	browser := "未知浏览器"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := "未知系统"
+	for _, o := range []struct{ token, name string }{
+		{"Windows", "Windows"}, {"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			system = o.name
+			break
+		}
+	}
+	return browser + " / " + system
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+func (s *SessionService) createRefreshToken(tx *gorm.DB, session *models.Session) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	err = tx.Create(&models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: session.ExpiresAt,
+	}).Error
+	return token, err
+}
+
+func (s *SessionService) tokenPair(session *models.Session, refresh string) (*TokenPair, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": session.UserID,
+		"sid":    session.ID,
+		"exp":    time.Now().Add(s.AccessTTL).Unix(),
+	})
+	access, err := token.SignedString([]byte(s.Secret))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(s.AccessTTL / time.Second),
+	}, nil
+}
+
+// newToken 生成 256 位的随机令牌
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 令牌本身是高熵随机数，SHA-256 即可，无需 bcrypt
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SplitTagNames 拆分逗号分隔的标签字符串，去掉空白和重复项
+func SplitTagNames(s string) []string {
+	return NormalizeTagNames(strings.Split(s, ","))
+}
+
+// NormalizeTagNames 去掉标签名的首尾空白、空值和重复项，保持原有顺序
+func NormalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// ResolveTags 按名称查找用户的标签，不存在的自动创建
+func ResolveTags(tx *gorm.DB, userID uint, names []string) ([]models.Tag, error) {
+	names = NormalizeTagNames(names)
+	if len(names) == 0 {
+		return []models.Tag{}, nil
+	}
+
+	var existing []models.Tag
+	if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Tag, len(existing))
+	for _, tag := range existing {
+		byName[tag.Name] = tag
+	}
+
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag, ok := byName[name]
+		if !ok {
+			tag = models.Tag{UserID: userID, Name: name}
+			if err := tx.Create(&tag).Error; err != nil {
+				return nil, err
+			}
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// legacyNameLength 标签名和分类名字段的长度上限（Tag.Name、Category.Name）
+const legacyNameLength = 50
+
+// truncateLegacyName 截断旧数据中超过字段长度的名称，避免迁移时插入失败
+func truncateLegacyName(name string) string {
+	if utf8.RuneCountInString(name) <= legacyNameLength {
+		return name
+	}
+	truncated := strings.TrimSpace(string([]rune(name)[:legacyNameLength]))
+	log.Printf("名称超过 %d 个字符，已截断: %q -> %q", legacyNameLength, name, truncated)
+	return truncated
+}
+
+// MigrateLegacyTags 将旧版 tasks.tags 中逗号分隔的标签拆分为 Tag 记录，迁移完成后删除该列
+func MigrateLegacyTags(db *gorm.DB) error {
+	// Task.Tags 现在是关联字段，这里必须用表名访问旧列
+	if !db.Migrator().HasColumn("tasks", "tags") {
+		return nil
+	}
+
+	var rows []struct {
+		ID     uint
+		UserID uint
+		Tags   string
+	}
+	if err := db.Table("tasks").Select("id, user_id, tags").Where("tags IS NOT NULL AND tags <> ''").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			names := SplitTagNames(row.Tags)
+			for i := range names {
+				names[i] = truncateLegacyName(names[i])
+			}
+			tags, err := ResolveTags(tx, row.UserID, names)
+			if err != nil {
+				return err
+			}
+			if len(tags) == 0 {
+				continue
+			}
+			task := models.Task{Model: gorm.Model{ID: row.ID}}
+			if err := tx.Model(&task).Omit("Tags.*").Association("Tags").Append(tags); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn("tasks", "tags")
+	})
+}
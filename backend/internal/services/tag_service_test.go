@@ -0,0 +1,20 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateLegacyName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"work", "work"},
+		{strings.Repeat("标", 50), strings.Repeat("标", 50)},
+		{strings.Repeat("标", 60), strings.Repeat("标", 50)},
+		{strings.Repeat("a", 49) + " tail", strings.Repeat("a", 49)},
+	}
+	for _, tt := range tests {
+		if got := truncateLegacyName(tt.name); got != tt.want {
+			t.Errorf("truncateLegacyName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
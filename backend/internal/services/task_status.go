@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 允许的状态流转，键为当前状态
+var taskTransitions = map[string][]string{
+	models.TaskStatusTodo:       {models.TaskStatusInProgress, models.TaskStatusBlocked, models.TaskStatusDone, models.TaskStatusCancelled},
+	models.TaskStatusInProgress: {models.TaskStatusTodo, models.TaskStatusBlocked, models.TaskStatusDone, models.TaskStatusCancelled},
+	models.TaskStatusBlocked:    {models.TaskStatusTodo, models.TaskStatusInProgress, models.TaskStatusCancelled},
+	models.TaskStatusDone:       {models.TaskStatusTodo, models.TaskStatusInProgress},
+	models.TaskStatusCancelled:  {models.TaskStatusTodo},
+}
+
+// IsValidTaskStatus 判断是否为合法的任务状态
+func IsValidTaskStatus(status string) bool {
+	_, ok := taskTransitions[status]
+	return ok
+}
+
+// IsValidPriority 判断是否为合法的优先级
+func IsValidPriority(priority int) bool {
+	return priority >= models.PriorityNone && priority <= models.PriorityUrgent
+}
+
+// ChangeTaskStatus 校验状态流转并更新任务状态，同步 Completed 字段（不保存）
+func ChangeTaskStatus(task *models.Task, status string) error {
+	if !IsValidTaskStatus(status) {
+		return fmt.Errorf("无效的任务状态 %q", status)
+	}
+	if task.Status == status {
+		return nil
+	}
+	from := task.Status
+	if from == "" {
+		from = models.TaskStatusTodo
+	}
+	allowed := false
+	for _, to := range taskTransitions[from] {
+		if to == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("任务状态不能从 %s 变为 %s", from, status)
+	}
+	task.Status = status
+	task.Completed = status == models.TaskStatusDone
+	return nil
+}
+
+// MigrateTaskStatus 根据旧版 Completed 字段补齐任务状态
+func MigrateTaskStatus(db *gorm.DB) error {
+	if err := db.Model(&models.Task{}).
+		Where("completed = ? AND (status IS NULL OR status IN ?)", true, []string{"", models.TaskStatusTodo}).
+		Update("status", models.TaskStatusDone).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.Task{}).
+		Where("status IS NULL OR status = ?", "").
+		Update("status", models.TaskStatusTodo).Error
+}
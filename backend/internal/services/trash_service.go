@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PurgeTasks 物理删除任务及其关联资料（包括存储中的文件）
+func PurgeTasks(db *gorm.DB, uploads *UploadService, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var removed []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var resources []models.TaskResource
+		if err := tx.Unscoped().Where("task_id IN ?", ids).Find(&resources).Error; err != nil {
+			return err
+		}
+		var seriesIDs []uint
+		if err := tx.Model(&models.Task{}).Distinct("series_id").
+			Where("id IN ? AND series_id IS NOT NULL", ids).Pluck("series_id", &seriesIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("task_id IN ?", ids).Delete(&models.TaskResource{}).Error; err != nil {
+			return err
+		}
+		var err error
+		if removed, err = ReleaseResources(tx, resources); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_tags WHERE task_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("task_id IN ?", ids).Delete(&models.Subtask{}).Error; err != nil {
+			return err
+		}
+		if err := removeDependencies(tx, ids); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Task{}).Error; err != nil {
+			return err
+		}
+		return purgeOrphanedSeries(tx, seriesIDs)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 数据库记录删除成功后再删除文件，文件删除失败只记录日志
+	uploads.RemoveFiles(context.Background(), removed)
+	return nil
+}
+
+// purgeOrphanedSeries 删除已没有任何任务引用的重复规则及其标签
+func purgeOrphanedSeries(tx *gorm.DB, seriesIDs []uint) error {
+	if len(seriesIDs) == 0 {
+		return nil
+	}
+	var orphaned []uint
+	if err := tx.Model(&models.TaskSeries{}).
+		Where("id IN ? AND id NOT IN (SELECT series_id FROM tasks WHERE series_id IS NOT NULL)", seriesIDs).
+		Pluck("id", &orphaned).Error; err != nil {
+		return err
+	}
+	if len(orphaned) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM task_series_tags WHERE task_series_id IN ?", orphaned).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", orphaned).Delete(&models.TaskSeries{}).Error
+}
+
+// PurgeExpiredTrash 彻底删除在回收站中超过保留期的任务，返回删除数量
+func PurgeExpiredTrash(db *gorm.DB, uploads *UploadService, retention time.Duration) (int, error) {
+	var ids []uint
+	cutoff := time.Now().Add(-retention)
+	if err := db.Model(&models.Task{}).
+		Where("is_deleted = ? AND trashed_at IS NOT NULL AND trashed_at < ?", true, cutoff).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if err := PurgeTasks(db, uploads, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// RunTrashPurger 定期清理过期的回收站任务，直到 ctx 被取消
+func RunTrashPurger(ctx context.Context, db *gorm.DB, uploads *UploadService, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		log.Printf("回收站保留时长和清理间隔必须为正数，不自动清理回收站")
+		return
+	}
+	// 旧数据没有记录移入回收站的时间，用最后更新时间补齐
+	if err := db.Model(&models.Task{}).
+		Where("is_deleted = ? AND trashed_at IS NULL", true).
+		Update("trashed_at", gorm.Expr("updated_at")).Error; err != nil {
+		log.Printf("补齐回收站时间失败: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := PurgeExpiredTrash(db, uploads, retention)
+		if err != nil {
+			log.Printf("清理回收站失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已彻底删除 %d 个过期的回收站任务", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
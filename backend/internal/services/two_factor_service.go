@@ -0,0 +1,255 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("两步验证已开启")
+	ErrTwoFactorNotEnabled  = errors.New("两步验证未开启")
+	ErrTwoFactorNotSetup    = errors.New("请先获取两步验证密钥")
+	ErrInvalidTwoFactorCode = errors.New("验证码错误")
+	ErrInvalidChallenge     = errors.New("登录验证已失效，请重新登录")
+)
+
+const (
+	recoveryCodeCount = 10
+	// 每次登录验证允许输错动态码的次数，超过后需要重新输入密码
+	maxChallengeAttempts = 5
+)
+
+// TwoFactorService TOTP 两步验证：开启、关闭，以及登录时的二次验证
+type TwoFactorService struct {
+	DB           *gorm.DB
+	Issuer       string
+	ChallengeTTL time.Duration
+}
+
+func NewTwoFactorService(db *gorm.DB, issuer string, challengeTTL time.Duration) *TwoFactorService {
+	return &TwoFactorService{DB: db, Issuer: issuer, ChallengeTTL: challengeTTL}
+}
+
+// Setup 生成新的密钥并保存为待确认状态，返回密钥和 otpauth 地址；确认之前不影响登录
+func (t *TwoFactorService) Setup(user *models.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := t.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(t.Issuer, user.Username, secret), nil
+}
+
+// Enable 用验证器应用生成的第一个动态码确认密钥并开启两步验证，返回新的恢复码（只在此时显示一次）
+func (t *TwoFactorService) Enable(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetup
+	}
+	step, ok := ValidateTOTP(user.TOTPSecret, normalizeCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		c, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = c
+		records[i] = models.RecoveryCode{UserID: user.ID, CodeHash: hashToken(normalizeCode(c))}
+	}
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable 校验动态码或恢复码后关闭两步验证，清除密钥和恢复码
+func (t *TwoFactorService) Disable(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := t.verifyCode(tx, user, code); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+	})
+}
+
+// CreateChallenge 密码验证通过后创建登录验证，返回给客户端的令牌用于提交动态码
+func (t *TwoFactorService) CreateChallenge(userID uint) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	// 顺带清理过期的记录
+	t.DB.Where("expires_at < ?", now).Delete(&models.TwoFactorChallenge{})
+	err = t.DB.Create(&models.TwoFactorChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(t.ChallengeTTL),
+	}).Error
+	return token, err
+}
+
+// ChallengeUser 返回仍然有效的登录验证对应的用户，用于提交动态码前检查登录限制
+func (t *TwoFactorService) ChallengeUser(token string) (*models.User, error) {
+	var challenge models.TwoFactorChallenge
+	if err := t.DB.Where("token_hash = ?", hashToken(token)).First(&challenge).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return nil, ErrInvalidChallenge
+	}
+	var user models.User
+	if err := t.DB.First(&user, challenge.UserID).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	return &user, nil
+}
+
+// CompleteChallenge 用登录验证令牌和动态码（或恢复码）完成登录，返回对应的用户；
+// 令牌只能成功使用一次，输错次数过多后失效。验证码错误时同时返回用户，便于调用方记录登录失败
+func (t *TwoFactorService) CompleteChallenge(token, code string) (*models.User, error) {
+	var challenge models.TwoFactorChallenge
+	if err := t.DB.Where("token_hash = ?", hashToken(token)).First(&challenge).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	now := time.Now()
+	if challenge.UsedAt != nil || now.After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return nil, ErrInvalidChallenge
+	}
+	var user models.User
+	if err := t.DB.First(&user, challenge.UserID).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrInvalidChallenge
+	}
+
+	// 先计入尝试次数，并发提交也不能超过上限
+	result := t.DB.Model(&challenge).
+		Where("used_at IS NULL AND attempts < ?", maxChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := t.verifyCode(tx, &user, code); err != nil {
+			return err
+		}
+		result := tx.Model(&challenge).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidChallenge
+		}
+		return nil
+	})
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return &user, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// verifyCode 校验 6 位动态码或恢复码。动态码的时间片必须晚于上次使用的，恢复码使用后作废
+func (t *TwoFactorService) verifyCode(tx *gorm.DB, user *models.User, code string) error {
+	code = normalizeCode(code)
+	if len(code) == totpDigits {
+		step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		// 条件更新，并发提交同一动态码时只有一个请求能成功
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// RemainingRecoveryCodes 未使用的恢复码数量
+func (t *TwoFactorService) RemainingRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := t.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// newRecoveryCode 生成形如 xxxxx-xxxxx 的恢复码（50 位随机数）
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// normalizeCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	return strings.ToLower(code)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"backend/internal/storage"
+)
+
+// UploadKind 上传类型，同时作为保存目录名
+type UploadKind string
+
+const (
+	UploadAvatar     UploadKind = "avatars"
+	UploadBackground UploadKind = "backgrounds"
+	UploadAttachment UploadKind = "attachments"
+)
+
+var (
+	ErrFileTooLarge       = errors.New("文件大小超过限制")
+	ErrFileTypeNotAllowed = errors.New("不支持的文件类型")
+)
+
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// 各类上传允许的 MIME 类型（按文件内容识别，不信任客户端声明）
+var allowedUploadTypes = map[UploadKind][]string{
+	UploadAvatar:     imageTypes,
+	UploadBackground: imageTypes,
+	// 附件下载时总是作为 attachment 返回，无法识别的二进制文件（如 .doc）也允许，
+	// 但拒绝 HTML 等可能被浏览器直接执行的内容
+	UploadAttachment: append([]string{
+		"application/pdf", "text/plain", "text/csv", "application/json",
+		"application/zip", "application/x-gzip", "application/x-rar-compressed",
+		"audio/mpeg", "audio/wave", "video/mp4", "video/webm",
+		"application/octet-stream",
+	}, imageTypes...),
+}
+
+// 通过后端访问头像、背景等公开文件的地址前缀，见 FileController
+const PublicFilePrefix = "/api/files/"
+
+// StoredFile 保存后的文件信息
+type StoredFile struct {
+	Key         string // 存储中的路径，如 attachments/1/xxx.pdf
+	Size        int64
+	ContentType string
+	SHA256      string
+}
+
+// UploadService 统一处理上传文件的校验和保存
+type UploadService struct {
+	Store  storage.Storage
+	Limits map[UploadKind]int64 // 单个文件的大小上限，字节
+	Quota  int64                // 每个用户默认的存储配额，字节，0 表示不限制
+}
+
+func NewUploadService(store storage.Storage, limits map[UploadKind]int64, quota int64) *UploadService {
+	return &UploadService{Store: store, Limits: limits, Quota: quota}
+}
+
+// Save 校验大小和内容类型后保存为 类型/用户ID/随机文件名
+func (s *UploadService) Save(ctx context.Context, userID uint, kind UploadKind, file *multipart.FileHeader) (*StoredFile, error) {
+	limit := s.Limits[kind]
+	if limit > 0 && file.Size > limit {
+		return nil, ErrFileTooLarge
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := detectContentType(head, file.Filename)
+	if !isAllowedType(kind, contentType) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s/%d/%s%s", kind, userID, name, safeExt(file.Filename, contentType))
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), src), io.MultiWriter(hash, counter))
+	if err := s.Store.Put(ctx, key, body, file.Size, contentType); err != nil {
+		return nil, err
+	}
+	// 客户端声明的大小不可信，以实际写入的为准
+	if limit > 0 && counter.n > limit {
+		s.Store.Delete(ctx, key)
+		return nil, ErrFileTooLarge
+	}
+
+	return &StoredFile{
+		Key:         key,
+		Size:        counter.n,
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Remove 删除已保存的文件，key 不属于上传目录时不做处理
+func (s *UploadService) Remove(ctx context.Context, key string) error {
+	if !isUploadKey(key) {
+		return nil
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+// PublicURL 头像、背景等文件对外的访问地址
+func (s *UploadService) PublicURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return PublicFilePrefix + key
+}
+
+// KeyFromURL 从 PublicURL 生成的地址中取回 key，只接受该用户自己的 kind 类文件（<kind>/<userID>/），
+// 其他地址返回空字符串，替换头像、背景时不会删除别人的文件或共享的附件
+func (s *UploadService) KeyFromURL(url string, kind UploadKind, userID uint) string {
+	key, ok := strings.CutPrefix(url, PublicFilePrefix)
+	if !ok || kind == UploadAttachment {
+		return ""
+	}
+	rest, ok := strings.CutPrefix(key, fmt.Sprintf("%s/%d/", kind, userID))
+	if !ok || rest == "" || strings.ContainsAny(rest, `/\`) || path.Clean(key) != key {
+		return ""
+	}
+	return key
+}
+
+// isUploadKey 判断 key 是否由 Save 生成
+func isUploadKey(key string) bool {
+	for _, kind := range []UploadKind{UploadAvatar, UploadBackground, UploadAttachment} {
+		if strings.HasPrefix(key, string(kind)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// detectContentType 根据文件头识别类型；纯文本再按扩展名细分（如 csv、json）
+func detectContentType(head []byte, filename string) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if contentType == "text/plain" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			return "text/csv"
+		case ".json":
+			return "application/json"
+		}
+	}
+	return contentType
+}
+
+func isAllowedType(kind UploadKind, contentType string) bool {
+	for _, t := range allowedUploadTypes[kind] {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// safeExt 图片按识别出的类型决定扩展名，其他文件保留原扩展名中的字母数字
+func safeExt(filename, contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	ext := strings.ToLower(filepath.Ext(filepath.Base(filename)))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
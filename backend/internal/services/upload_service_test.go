@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestKeyFromURL(t *testing.T) {
+	s := NewUploadService(nil, nil, 0)
+	tests := []struct {
+		url  string
+		kind UploadKind
+		want string
+	}{
+		{"/api/files/backgrounds/7/abc.jpg", UploadBackground, "backgrounds/7/abc.jpg"},
+		{"/api/files/avatars/7/abc_256.png", UploadAvatar, "avatars/7/abc_256.png"},
+		// 其他用户的文件
+		{"/api/files/backgrounds/8/abc.jpg", UploadBackground, ""},
+		{"/api/files/backgrounds/70/abc.jpg", UploadBackground, ""},
+		// 类型不符或共享的附件
+		{"/api/files/avatars/7/abc.jpg", UploadBackground, ""},
+		{"/api/files/attachments/sha256/ab/abcd", UploadBackground, ""},
+		{"/api/files/attachments/7/a.pdf", UploadAttachment, ""},
+		// 路径穿越和其他地址
+		{"/api/files/backgrounds/7/../8/abc.jpg", UploadBackground, ""},
+		{"/api/files/backgrounds/7/..", UploadBackground, ""},
+		{"/api/files/backgrounds/7/", UploadBackground, ""},
+		{"https://example.com/backgrounds/7/abc.jpg", UploadBackground, ""},
+	}
+	for _, tt := range tests {
+		if got := s.KeyFromURL(tt.url, tt.kind, 7); got != tt.want {
+			t.Errorf("KeyFromURL(%q, %s) = %q, want %q", tt.url, tt.kind, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"backend/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("文件不存在")
+	ErrInvalidKey = errors.New("文件路径不合法")
+)
+
+// Object 读取到的文件，使用后需要关闭 Body
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage 文件存储后端，key 为 / 分隔的相对路径，如 attachments/1/xxx.pdf
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet 返回有时效的直接下载地址，filename 非空时作为下载文件名；不支持时返回空字符串
+	PresignGet(ctx context.Context, key, filename string) (string, error)
+}
+
+// New 按配置创建存储后端
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		return NewLocal(cfg.UploadDir), nil
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:      cfg.S3Endpoint,
+			Region:        cfg.S3Region,
+			Bucket:        cfg.S3Bucket,
+			AccessKey:     cfg.S3AccessKey,
+			SecretKey:     cfg.S3SecretKey,
+			PathStyle:     cfg.S3PathStyle,
+			PresignExpiry: cfg.S3PresignExpiry,
+		})
+	default:
+		return nil, fmt.Errorf("未知的存储类型: %s", cfg.StorageDriver)
+	}
+}
+
+// cleanKey 校验 key，拒绝绝对路径和 .. 之类可能越出存储根目录的写法
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, `\`) || strings.HasPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
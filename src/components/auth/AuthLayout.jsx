@@ -1,6 +1,7 @@
 import { Outlet, Link, useNavigate } from 'react-router-dom';
 import { useState, useEffect } from 'react';
 import UserProfileModal from '../settings/UserProfileModal';
+import { logout } from '../../services/authService';
 
 export default function AuthLayout() {
   const [user, setUser] = useState(() => {
@@ -15,8 +16,14 @@ export default function AuthLayout() {
     if (user) localStorage.setItem('user', JSON.stringify(user));
   }, [user]);
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    try {
+      await logout();
+    } catch (e) {
+      // 会话已失效时直接清除本地登录状态
+    }
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('user');
     setUser(null);
     navigate('/login');
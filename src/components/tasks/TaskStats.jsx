@@ -4,8 +4,8 @@ const COLORS = ['#0088FE', '#00C49F', '#FFBB28'];
 
 export default function TaskStats({ tasks }) {
   const data = [
-    { name: '已完成', value: tasks.filter(t => t.status === 'completed').length },
-    { name: '进行中', value: tasks.filter(t => t.status === 'pending').length },
+    { name: '已完成', value: tasks.filter(t => t.status === 'done').length },
+    { name: '进行中', value: tasks.filter(t => t.status === 'in_progress').length },
     { name: '已过期', value: tasks.filter(t => new Date(t.dueDate) < new Date()).length }
   ];
 
@@ -44,7 +44,8 @@ export default function Dashboard() {
   // 分类统计
   const categoryMap = {};
   activeTasks.forEach(t => {
-    categoryMap[t.category || '未分类'] = (categoryMap[t.category || '未分类'] || 0) + 1;
+    const name = t.category?.name || '未分类';
+    categoryMap[name] = (categoryMap[name] || 0) + 1;
   });
 
   // 最近到期任务
@@ -0,0 +1,32 @@
+import { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { forgotPassword } from '../services/authService';
+
+export default function ForgotPassword() {
+  const [email, setEmail] = useState('');
+  const [message, setMessage] = useState('');
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    try {
+      const res = await forgotPassword(email);
+      setMessage(res.data.msg);
+    } catch (err) {
+      setMessage('网络错误或服务器异常');
+    }
+  };
+
+  return (
+    <div className="auth-container">
+      <h2>找回密码</h2>
+      <form onSubmit={handleSubmit}>
+        <input type="email" value={email} onChange={e => setEmail(e.target.value)} placeholder="注册邮箱" required />
+        <button type="submit">发送重置邮件</button>
+      </form>
+      {message && <div>{message}</div>}
+      <div style={{ marginTop: 16 }}>
+        <Link to="/login">返回登录</Link>
+      </div>
+    </div>
+  );
+}
\ No newline at end of file
@@ -1,30 +1,93 @@
-import { useState } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
-import { login } from '../services/authService';
+import { useEffect, useState } from 'react';
+import { useNavigate, useLocation, Link } from 'react-router-dom';
+import { login, verifyTwoFactor, getOIDCConfig, oidcAuthorize } from '../services/authService';
 
 export default function Login() {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
-  const [error, setError] = useState('');
+  const location = useLocation();
+  // 第三方登录后需要两步验证时，回调页面带着 challengeToken 跳转过来
+  const [challengeToken, setChallengeToken] = useState(location.state?.challengeToken || '');
+  const [code, setCode] = useState('');
+  const [error, setError] = useState(location.state?.error || '');
+  const [oidc, setOidc] = useState(null);
   const navigate = useNavigate();
 
+  useEffect(() => {
+    getOIDCConfig()
+      .then(res => setOidc(res.data.data))
+      .catch(() => setOidc(null));
+  }, []);
+
+  const saveLogin = (data) => {
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refreshToken', data.refreshToken);
+    localStorage.setItem('user', JSON.stringify(data.user));
+    navigate('/');
+  };
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     setError('');
     try {
       const res = await login(username, password);
       if (res.data.code === 0) {
-        localStorage.setItem('token', res.data.data.token);
-        localStorage.setItem('user', JSON.stringify(res.data.data.user));
-        navigate('/');
+        // 开启了两步验证，继续输入动态码
+        if (res.data.data.twoFactorRequired) {
+          setChallengeToken(res.data.data.challengeToken);
+          return;
+        }
+        saveLogin(res.data.data);
       } else {
         setError(res.data.msg || '登录失败');
       }
     } catch (err) {
-      setError('网络错误或服务器异常');
+      // 失败次数过多被临时锁定（429）等情况，使用服务端的提示
+      setError(err.response?.data?.msg || '网络错误或服务器异常');
+    }
+  };
+
+  const handleOIDCLogin = async () => {
+    setError('');
+    try {
+      const res = await oidcAuthorize();
+      // 回调时比对 state，防止被诱导登录到他人的账号
+      sessionStorage.setItem('oidcState', res.data.data.state);
+      window.location.href = res.data.data.url;
+    } catch (err) {
+      setError(err.response?.data?.msg || '第三方登录失败');
     }
   };
 
+  const handleVerify = async (e) => {
+    e.preventDefault();
+    setError('');
+    try {
+      const res = await verifyTwoFactor(challengeToken, code);
+      saveLogin(res.data.data);
+    } catch (err) {
+      setError(err.response?.data?.msg || '验证失败');
+      // 登录验证失效后需要重新输入密码
+      if (err.response?.data?.msg === '登录验证已失效，请重新登录') {
+        setChallengeToken('');
+        setCode('');
+      }
+    }
+  };
+
+  if (challengeToken) {
+    return (
+      <div className="auth-container">
+        <h2>两步验证</h2>
+        <form onSubmit={handleVerify}>
+          <input value={code} onChange={e => setCode(e.target.value)} placeholder="验证器中的 6 位动态码或恢复码" autoComplete="one-time-code" required />
+          <button type="submit">验证</button>
+        </form>
+        {error && <div className="error">{error}</div>}
+      </div>
+    );
+  }
+
   return (
     <div className="auth-container">
       <h2>登录</h2>
@@ -33,9 +96,15 @@ export default function Login() {
         <input type="password" value={password} onChange={e => setPassword(e.target.value)} placeholder="密码" required />
         <button type="submit">登录</button>
       </form>
+      {oidc?.enabled && (
+        <button type="button" onClick={handleOIDCLogin} style={{ marginTop: 8 }}>
+          使用 {oidc.providerName} 登录
+        </button>
+      )}
       {error && <div className="error">{error}</div>}
       <div style={{ marginTop: 16 }}>
         还没有账号？<Link to="/register">注册</Link>
+        <Link to="/forgot-password" style={{ marginLeft: 8 }}>忘记密码？</Link>
       </div>
     </div>
   );
@@ -0,0 +1,46 @@
+import { useEffect, useRef } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { oidcCallback } from '../services/authService';
+
+export default function OIDCCallback() {
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  // 授权码只能使用一次，避免开发模式下重复执行
+  const handled = useRef(false);
+
+  useEffect(() => {
+    if (handled.current) return;
+    handled.current = true;
+
+    const code = searchParams.get('code');
+    const state = searchParams.get('state');
+    const expected = sessionStorage.getItem('oidcState');
+    sessionStorage.removeItem('oidcState');
+    if (searchParams.get('error') || !code || !state || state !== expected) {
+      navigate('/login', { replace: true, state: { error: '第三方登录失败，请重试' } });
+      return;
+    }
+
+    oidcCallback(code, state)
+      .then(res => {
+        const data = res.data.data;
+        if (data.twoFactorRequired) {
+          navigate('/login', { replace: true, state: { challengeToken: data.challengeToken } });
+          return;
+        }
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refreshToken', data.refreshToken);
+        localStorage.setItem('user', JSON.stringify(data.user));
+        navigate('/', { replace: true });
+      })
+      .catch(err => {
+        navigate('/login', { replace: true, state: { error: err.response?.data?.msg || '第三方登录失败' } });
+      });
+  }, [searchParams, navigate]);
+
+  return (
+    <div className="auth-container">
+      <div>正在登录...</div>
+    </div>
+  );
+}
\ No newline at end of file
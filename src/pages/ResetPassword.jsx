@@ -0,0 +1,40 @@
+import { useState } from 'react';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+import { resetPassword } from '../services/authService';
+
+export default function ResetPassword() {
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState('');
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+    try {
+      const res = await resetPassword(searchParams.get('token') || '', password);
+      if (res.data.code === 0) {
+        alert(res.data.msg);
+        navigate('/login');
+      } else {
+        setError(res.data.msg || '重置失败');
+      }
+    } catch (err) {
+      setError(err.response?.data?.msg || '网络错误或服务器异常');
+    }
+  };
+
+  return (
+    <div className="auth-container">
+      <h2>设置新密码</h2>
+      <form onSubmit={handleSubmit}>
+        <input type="password" value={password} onChange={e => setPassword(e.target.value)} placeholder="新密码（至少 8 位）" minLength={8} required />
+        <button type="submit">重置密码</button>
+      </form>
+      {error && <div className="error">{error}</div>}
+      <div style={{ marginTop: 16 }}>
+        <Link to="/login">返回登录</Link>
+      </div>
+    </div>
+  );
+}
\ No newline at end of file
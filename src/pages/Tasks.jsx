@@ -60,8 +60,7 @@ export default function Tasks() {
   };
 
   const handleUpdateDueDate = async (id, value) => {
-    const task = tasks.find(t => t.id === id);
-    const res = await updateTask(id, { ...task, dueDate: value });
+    const res = await updateTask(id, { dueDate: value });
     if (res.data.code === 0) {
       setTasks(tasks.map(t => t.id === id ? { ...t, dueDate: value } : t));
     } else {
@@ -76,8 +75,7 @@ export default function Tasks() {
   };
 
   const handleDescChange = async (id, value) => {
-    const task = tasks.find(t => t.id === id);
-    const res = await updateTask(id, { ...task, description: value });
+    const res = await updateTask(id, { description: value });
     if (res.data.code === 0) {
       setTasks(tasks.map(t => t.id === id ? { ...t, description: value } : t));
     } else {
@@ -86,17 +84,20 @@ export default function Tasks() {
   };
 
   const handleTagsChange = async (id, value) => {
-    const task = tasks.find(t => t.id === id);
-    const res = await updateTask(id, { ...task, tags: value });
+    const res = await updateTask(id, { tags: value });
     if (res.data.code === 0) {
-      setTasks(tasks.map(t => t.id === id ? { ...t, tags: value } : t));
+      setTasks(tasks.map(t => t.id === id ? { ...t, tags: res.data.data.tags } : t));
     }
   };
 
   const handleCategoryChange = async (id, newCategory) => {
     if (!id) return;
-    await updateTask(id, { category: newCategory });
-    setTasks(tasks.map(t => t.id === id ? { ...t, category: newCategory } : t));
+    const res = await updateTask(id, newCategory ? { category: newCategory } : { categoryId: 0 });
+    if (res.data.code === 0) {
+      setTasks(tasks.map(t => t.id === id ? { ...t, category: res.data.data.category } : t));
+    } else {
+      alert(res.data.msg || '修改失败');
+    }
   };
 
   const sortedTasks = [...tasks].sort((a, b) => new Date(a.dueDate) - new Date(b.dueDate));
@@ -165,7 +166,7 @@ export default function Tasks() {
               <span style={{ color: '#888', fontSize: 13 }}>
                 分类：
                 <select
-                  value={task.category || ''}
+                  value={task.category ? task.category.name : ''}
                   onChange={e => handleCategoryChange(task.id, e.target.value)}
                   style={{ marginLeft: 4 }}
                 >
@@ -179,8 +180,8 @@ export default function Tasks() {
                 标签：
                 <input
                   type="text"
-                  value={task.tags || ''}
-                  onChange={e => handleTagsChange(task.id, e.target.value)}
+                  defaultValue={(task.tags || []).map(tag => tag.name).join(',')}
+                  onBlur={e => handleTagsChange(task.id, e.target.value)}
                   style={{ width: 120, marginLeft: 4 }}
                   placeholder="用逗号分隔"
                 />
@@ -190,7 +191,7 @@ export default function Tasks() {
               截止时间：
               <input
                 type="date"
-                value={task.dueDate ? task.dueDate.split(' ')[0] : ''} // 只取日期部分
+                value={task.dueDate ? task.dueDate.split('T')[0] : ''} // 只取日期部分
                 onChange={e => handleUpdateDueDate(task.id, e.target.value)}
                 style={{ marginLeft: 4 }}
               />
@@ -1,12 +1,12 @@
-import { fetchTasks, updateTask, removeTaskPermanently } from '../services/taskService';
+import { fetchTrash, restoreTask, removeTaskPermanently } from '../services/taskService';
 import { useEffect, useState } from 'react';
 
 export default function Trash() {
   const [tasks, setTasks] = useState([]);
 
   const loadTasks = () => {
-    fetchTasks().then(res => {
-      if (res.data.code === 0) setTasks(res.data.data.filter(t => t.isDeleted));
+    fetchTrash().then(res => {
+      if (res.data.code === 0) setTasks(res.data.data);
     });
   };
 
@@ -15,7 +15,7 @@ export default function Trash() {
   }, []);
 
   const handleRestore = async (id) => {
-    await updateTask(id, { isDeleted: false });
+    await restoreTask(id);
     setTasks(tasks.filter(t => t.id !== id));
   };
 
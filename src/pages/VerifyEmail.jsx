@@ -0,0 +1,24 @@
+import { useEffect, useState } from 'react';
+import { useSearchParams, Link } from 'react-router-dom';
+import { verifyEmail } from '../services/authService';
+
+export default function VerifyEmail() {
+  const [searchParams] = useSearchParams();
+  const [message, setMessage] = useState('正在验证邮箱...');
+
+  useEffect(() => {
+    verifyEmail(searchParams.get('token') || '')
+      .then(res => setMessage(res.data.msg))
+      .catch(err => setMessage(err.response?.data?.msg || '验证失败'));
+  }, [searchParams]);
+
+  return (
+    <div className="auth-container">
+      <h2>邮箱验证</h2>
+      <div>{message}</div>
+      <div style={{ marginTop: 16 }}>
+        <Link to="/">返回首页</Link>
+      </div>
+    </div>
+  );
+}
\ No newline at end of file
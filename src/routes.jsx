@@ -6,6 +6,10 @@ import Trash from "./pages/Trash";
 import Settings from "./pages/Settings";
 import Login from "./pages/Login";
 import Register from "./pages/Register";
+import ForgotPassword from "./pages/ForgotPassword";
+import ResetPassword from "./pages/ResetPassword";
+import VerifyEmail from "./pages/VerifyEmail";
+import OIDCCallback from "./pages/OIDCCallback";
 
 export const router = createBrowserRouter([
   {
@@ -19,5 +23,9 @@ export const router = createBrowserRouter([
     ]
   },
   { path: '/login', element: <Login /> },
-  { path: '/register', element: <Register /> }
+  { path: '/register', element: <Register /> },
+  { path: '/forgot-password', element: <ForgotPassword /> },
+  { path: '/reset-password', element: <ResetPassword /> },
+  { path: '/verify-email', element: <VerifyEmail /> },
+  { path: '/oidc/callback', element: <OIDCCallback /> }
 ]);
\ No newline at end of file
@@ -4,6 +4,35 @@ import request from '../utils/request';
 export const login = (username, password) =>
   request.post('/auth/login', { username, password });
 
+// 两步验证：提交登录时返回的 challengeToken 和动态码（或恢复码）
+export const verifyTwoFactor = (challengeToken, code) =>
+  request.post('/auth/2fa/verify', { challengeToken, code });
+
+// 第三方登录（OpenID Connect）是否启用
+export const getOIDCConfig = () => request.get('/auth/oidc');
+
+// 获取第三方登录的授权地址
+export const oidcAuthorize = () => request.get('/auth/oidc/authorize');
+
+// 第三方登录回调：提交授权码和 state 换取令牌
+export const oidcCallback = (code, state) =>
+  request.post('/auth/oidc/callback', { code, state });
+
 // 注册
 export const register = (username, password) =>
-  request.post('/auth/register', { username, password });
\ No newline at end of file
+  request.post('/auth/register', { username, password });
+
+// 发送重置密码邮件
+export const forgotPassword = (email) =>
+  request.post('/auth/forgot-password', { email });
+
+// 使用邮件中的令牌重置密码
+export const resetPassword = (token, newPassword) =>
+  request.post('/auth/reset-password', { token, newPassword });
+
+// 验证邮箱
+export const verifyEmail = (token) =>
+  request.post('/auth/verify-email', { token });
+
+// 退出登录，注销服务端会话
+export const logout = () => request.post('/auth/logout');
\ No newline at end of file
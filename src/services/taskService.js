@@ -1,7 +1,7 @@
 import request from '../utils/request';
 
 // 获取任务列表
-export const fetchTasks = () => request.get('/tasks'); // /api/tasks
+export const fetchTasks = (params) => request.get('/tasks', { params }); // /api/tasks
 
 // 新建任务
 export const createTask = (data) => request.post('/tasks', data);
@@ -20,3 +20,9 @@ export const removeTaskPermanently = (id) => request.delete(`/tasks/permanent/${
 // 恢复任务
 export const restoreTask = (id) => request.put(`/tasks/${id}/restore`);
 
+// 获取回收站任务
+export const fetchTrash = () => request.get('/tasks/trash');
+
+// 清空回收站
+export const emptyTrash = () => request.delete('/tasks/trash');
+
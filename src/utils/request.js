@@ -13,4 +13,28 @@ instance.interceptors.request.use(config => {
   return config;
 });
 
+// 访问令牌过期时用刷新令牌换取新令牌后重试，同一时间只刷新一次
+let refreshing = null;
+instance.interceptors.response.use(null, async error => {
+  const { config, response } = error;
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (response?.status !== 401 || !refreshToken || config._retried || config.url === '/auth/refresh') {
+    return Promise.reject(error);
+  }
+  config._retried = true;
+  try {
+    refreshing = refreshing || axios.post('/api/auth/refresh', { refreshToken });
+    const res = await refreshing;
+    localStorage.setItem('token', res.data.data.token);
+    localStorage.setItem('refreshToken', res.data.data.refreshToken);
+  } catch (e) {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    return Promise.reject(error);
+  } finally {
+    refreshing = null;
+  }
+  return instance(config);
+});
+
 export default instance;
\ No newline at end of file